@@ -1,18 +1,136 @@
 package consul
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"strconv"
 	"time"
 
+	"github.com/aocsolutions/mongoctl/discovery"
 	"github.com/hashicorp/consul/api"
 )
 
+// Agent talks to Consul through the agent at Server. Any field left
+// empty falls back to the Consul defaults, which can be set with the
+// standard CONSUL_HTTP_* environment variables.
 type Agent struct {
-	Server string
+	Server     string
+	Scheme     string
+	Datacenter string
+	Token      string
+
+	// CAFile, CertFile and KeyFile configure TLS to the agent.
+	CAFile   string
+	CertFile string
+	KeyFile  string
+
+	// Check is the health check registered with each service.
+	Check Check
+}
+
+// Check types for registrations.
+const (
+	CheckTCP    = "tcp"
+	CheckHTTP   = "http"
+	CheckTTL    = "ttl"
+	CheckScript = "script"
+	CheckNone   = "none"
+)
+
+// Check configures the health check of registered services. Empty
+// fields use the defaults, a TCP check every 15s.
+type Check struct {
+	// Type is one of the Check* types.
+	Type string
+
+	// Interval and Timeout apply to tcp, http and script checks.
+	Interval string
+	Timeout  string
+
+	// TTL is how long a ttl check stays passing without an update.
+	TTL string
+
+	// HTTP is the URL polled by http checks, such as the health
+	// endpoint of mongoctl agent.
+	HTTP string
+
+	// DeregisterCriticalAfter removes the service once its check has
+	// been critical for this long.
+	DeregisterCriticalAfter string
+}
+
+// DefaultCheckInterval and DefaultCheckTTL are used when the check does
+// not set them.
+const (
+	DefaultCheckInterval = "15s"
+	DefaultCheckTTL      = "30s"
+)
+
+// serviceCheck returns the check to register with service, or nil for
+// CheckNone.
+func (c *Agent) serviceCheck(service *discovery.Service) (*api.AgentServiceCheck, error) {
+	check := &api.AgentServiceCheck{
+		Interval:                       c.Check.Interval,
+		Timeout:                        c.Check.Timeout,
+		DeregisterCriticalServiceAfter: c.Check.DeregisterCriticalAfter,
+	}
+	if check.Interval == "" {
+		check.Interval = DefaultCheckInterval
+	}
+
+	switch c.Check.Type {
+	case "", CheckTCP:
+		check.TCP = service.String()
+	case CheckHTTP:
+		if c.Check.HTTP == "" {
+			return nil, errors.New("http checks need the URL to check")
+		}
+		check.HTTP = c.Check.HTTP
+	case CheckTTL:
+		check.Interval = ""
+		check.Timeout = ""
+		check.TTL = c.ttl()
+	case CheckScript:
+		check.Args = []string{"/bin/nc", "-zv", service.Addr, strconv.Itoa(service.Port)}
+	case CheckNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("Unknown check type %q, must be one of tcp, http, ttl, script or none", c.Check.Type)
+	}
+	return check, nil
+}
+
+func (c *Agent) ttl() string {
+	if c.Check.TTL == "" {
+		return DefaultCheckTTL
+	}
+	return c.Check.TTL
 }
 
 func (c *Agent) getClient() (cl *api.Client, err error) {
 	config := api.DefaultConfig()
+	if c.Server != "" {
+		config.Address = c.Server
+	}
+	if c.Scheme != "" {
+		config.Scheme = c.Scheme
+	}
+	if c.Datacenter != "" {
+		config.Datacenter = c.Datacenter
+	}
+	if c.Token != "" {
+		config.Token = c.Token
+	}
+	if c.CAFile != "" {
+		config.TLSConfig.CAFile = c.CAFile
+	}
+	if c.CertFile != "" {
+		config.TLSConfig.CertFile = c.CertFile
+	}
+	if c.KeyFile != "" {
+		config.TLSConfig.KeyFile = c.KeyFile
+	}
 
 	client, err := api.NewClient(config)
 	if err != nil {
@@ -37,33 +155,6 @@ func (c *Agent) GetCatalog() (catalog *api.Catalog, err error) {
 	return client.Catalog(), nil
 }
 
-func (c *Agent) AddService(addr, id, script, name string, port int) (err error) {
-	agent, err := c.GetAgent()
-	if err != nil {
-		return err
-	}
-
-	check := api.AgentServiceCheck{
-		Script:   script,
-		Interval: "15s",
-	}
-
-	service := &api.AgentServiceRegistration{
-		Address: addr,
-		Port:    port,
-		Name:    name,
-		ID:      id,
-		Check:   &check,
-	}
-
-	err = agent.ServiceRegister(service)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
 func (c *Agent) RemoveService(service *api.CatalogService) (err error) {
 	catalog, err := c.GetCatalog()
 	if err != nil {
@@ -95,3 +186,175 @@ func (c *Agent) GetService(name, tag string) (nodes []*api.CatalogService, err e
 	}
 	return nodes, nil
 }
+
+// Lookup implements discovery.Discovery using the Consul catalog.
+func (c *Agent) Lookup(name string) (services []*discovery.Service, err error) {
+	catalog, err := c.GetCatalog()
+	if err != nil {
+		return nil, err
+	}
+	nodes, _, err := catalog.Service(name, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range nodes {
+		services = append(services, &discovery.Service{
+			ID:   node.ServiceID,
+			Addr: node.Address,
+			Port: node.ServicePort,
+			Tags: node.ServiceTags,
+			Meta: node.ServiceMeta,
+		})
+	}
+	return services, nil
+}
+
+// Register implements discovery.Discovery by registering the service
+// with the local Consul agent. The tags and meta of the service are
+// registered with it, so registering again with the same ID updates
+// them, and a tag such as primary can be resolved through Consul DNS
+// as primary.<name>.service.consul.
+func (c *Agent) Register(name string, service *discovery.Service) error {
+	check, err := c.serviceCheck(service)
+	if err != nil {
+		return err
+	}
+	agent, err := c.GetAgent()
+	if err != nil {
+		return err
+	}
+
+	return agent.ServiceRegister(&api.AgentServiceRegistration{
+		Address: service.Addr,
+		Port:    service.Port,
+		Name:    name,
+		ID:      service.ID,
+		Tags:    service.Tags,
+		Meta:    service.Meta,
+		Check:   check,
+	})
+}
+
+// KeepAlive implements discovery.KeepAliver for ttl checks by passing
+// the check of the service with the given id every half TTL until ctx
+// is cancelled. It is a no-op for other check types.
+func (c *Agent) KeepAlive(ctx context.Context, name, id string) error {
+	if c.Check.Type != CheckTTL {
+		return nil
+	}
+	ttl, err := time.ParseDuration(c.ttl())
+	if err != nil {
+		return err
+	}
+	agent, err := c.GetAgent()
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(ttl / 2)
+	defer ticker.Stop()
+	for {
+		// A failed update is retried on the next tick, the check only
+		// goes critical if updates fail for the whole TTL.
+		agent.UpdateTTL("service:"+id, "", api.HealthPassing)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Deregister implements discovery.Discovery. Services registered with
+// the local agent are deregistered through it, as the agent would
+// otherwise restore them on its next anti-entropy sync. Others, such as
+// those of members whose node is gone, are removed from the catalog. A
+// service which isn't registered is not an error.
+func (c *Agent) Deregister(name string, service *discovery.Service) error {
+	client, err := c.getClient()
+	if err != nil {
+		return err
+	}
+
+	local, err := client.Agent().Services()
+	if err != nil {
+		return err
+	}
+	for id, registered := range local {
+		if registered.Service == name && (id == service.ID ||
+			(registered.Address == service.Addr && registered.Port == service.Port)) {
+			return client.Agent().ServiceDeregister(id)
+		}
+	}
+
+	nodes, _, err := client.Catalog().Service(name, "", nil)
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		if node.ServiceID == service.ID ||
+			(node.Address == service.Addr && node.ServicePort == service.Port) {
+			return c.RemoveService(node)
+		}
+	}
+	return nil
+}
+
+// Lock implements discovery.Locker with a session based lock on the
+// KV key mongoctl/<name>/lock. If the lock is not acquired within
+// timeout an error is returned. The session is invalidated if this
+// process goes away, so a crashed holder does not block others.
+func (c *Agent) Lock(name string, timeout time.Duration) (unlock func() error, err error) {
+	client, err := c.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := client.LockOpts(&api.LockOptions{
+		Key:          fmt.Sprintf("mongoctl/%s/lock", name),
+		SessionName:  "mongoctl",
+		LockWaitTime: timeout,
+		LockTryOnce:  true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	leaderCh, err := lock.Lock(nil)
+	if err != nil {
+		return nil, err
+	}
+	if leaderCh == nil {
+		return nil, fmt.Errorf("Timed out waiting for lock on %s", name)
+	}
+	return lock.Unlock, nil
+}
+
+// Get implements discovery.Storer with the KV key mongoctl/<name>/<key>.
+func (c *Agent) Get(name, key string) ([]byte, error) {
+	client, err := c.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	pair, _, err := client.KV().Get(fmt.Sprintf("mongoctl/%s/%s", name, key), nil)
+	if err != nil || pair == nil {
+		return nil, err
+	}
+	return pair.Value, nil
+}
+
+// Put implements discovery.Storer with the KV key mongoctl/<name>/<key>.
+func (c *Agent) Put(name, key string, value []byte) error {
+	client, err := c.getClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = client.KV().Put(&api.KVPair{
+		Key:   fmt.Sprintf("mongoctl/%s/%s", name, key),
+		Value: value,
+	}, nil)
+	return err
+}
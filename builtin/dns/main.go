@@ -0,0 +1,102 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aocsolutions/mongoctl/discovery"
+)
+
+// Resolver is a read only discovery backend which finds the members
+// of a cluster from the _<service>._tcp.<domain> SRV records, in the
+// same way as mongodb+srv connection strings.
+type Resolver struct {
+	// Domain is the domain the SRV and TXT records are published under.
+	Domain string
+
+	// Server is the host:port of the DNS server to query. If empty
+	// the system resolver is used.
+	Server string
+}
+
+func (r *Resolver) resolver() *net.Resolver {
+	if r.Server == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			d := net.Dialer{Timeout: 5 * time.Second}
+			return d.DialContext(ctx, network, r.Server)
+		},
+	}
+}
+
+// Lookup implements discovery.Discovery by resolving the SRV records
+// for name.
+func (r *Resolver) Lookup(name string) (services []*discovery.Service, err error) {
+	if r.Domain == "" {
+		return nil, fmt.Errorf("dns: no domain configured")
+	}
+
+	_, records, err := r.resolver().LookupSRV(context.Background(), name, "tcp", r.Domain)
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	for _, record := range records {
+		addr := strings.TrimSuffix(record.Target, ".")
+		services = append(services, &discovery.Service{
+			ID:   fmt.Sprintf("%s:%d", addr, record.Port),
+			Addr: addr,
+			Port: int(record.Port),
+		})
+	}
+	return services, nil
+}
+
+// Options implements discovery.Optioner by parsing the TXT record of
+// the domain, which holds connection options such as replicaSet and
+// authSource in URL query form.
+func (r *Resolver) Options(name string) (url.Values, error) {
+	records, err := r.resolver().LookupTXT(context.Background(), r.Domain)
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			return url.Values{}, nil
+		}
+		return nil, err
+	}
+	if len(records) > 1 {
+		return nil, fmt.Errorf("dns: multiple TXT records found for %s", r.Domain)
+	}
+
+	options := url.Values{}
+	for _, record := range records {
+		values, err := url.ParseQuery(record)
+		if err != nil {
+			return nil, fmt.Errorf("dns: invalid TXT record for %s: %s", r.Domain, err)
+		}
+		for key, value := range values {
+			options[key] = value
+		}
+	}
+	return options, nil
+}
+
+// Register is not supported since SRV records are managed outside of
+// mongoctl.
+func (r *Resolver) Register(name string, service *discovery.Service) error {
+	return discovery.ErrReadOnly
+}
+
+// Deregister is not supported since SRV records are managed outside of
+// mongoctl.
+func (r *Resolver) Deregister(name string, service *discovery.Service) error {
+	return discovery.ErrReadOnly
+}
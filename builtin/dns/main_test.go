@@ -0,0 +1,182 @@
+package dns
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/aocsolutions/mongoctl/discovery"
+	"github.com/miekg/dns"
+)
+
+// testServer serves the given records over UDP on a local port,
+// answering NXDOMAIN for any other name, and returns its address.
+func testServer(t *testing.T, records ...string) (string, func()) {
+	zone := make(map[string][]dns.RR)
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			t.Fatalf("bad record %q: %s", record, err)
+		}
+		name := dns.CanonicalName(rr.Header().Name)
+		zone[name] = append(zone[name], rr)
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	server := &dns.Server{
+		PacketConn: conn,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(req)
+			q := req.Question[0]
+			answers, ok := zone[dns.CanonicalName(q.Name)]
+			if !ok {
+				m.SetRcode(req, dns.RcodeNameError)
+			}
+			for _, rr := range answers {
+				if rr.Header().Rrtype == q.Qtype {
+					m.Answer = append(m.Answer, rr)
+				}
+			}
+			w.WriteMsg(m)
+		}),
+	}
+
+	started := make(chan struct{})
+	server.NotifyStartedFunc = func() { close(started) }
+	go server.ActivateAndServe()
+	<-started
+	return conn.LocalAddr().String(), func() { server.Shutdown() }
+}
+
+func TestResolverLookup(t *testing.T) {
+	addr, stop := testServer(t,
+		"_mongodb._tcp.example.com. 60 IN SRV 0 0 27017 db1.example.com.",
+		"_mongodb._tcp.example.com. 60 IN SRV 0 0 27018 db2.example.com.",
+	)
+	defer stop()
+
+	r := &Resolver{Domain: "example.com", Server: addr}
+	services, err := r.Lookup("mongodb")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[string]*discovery.Service{
+		"db1.example.com:27017": {ID: "db1.example.com:27017", Addr: "db1.example.com", Port: 27017},
+		"db2.example.com:27018": {ID: "db2.example.com:27018", Addr: "db2.example.com", Port: 27018},
+	}
+	if len(services) != len(expected) {
+		t.Fatalf("expected %d services, got %d", len(expected), len(services))
+	}
+	for _, service := range services {
+		if !reflect.DeepEqual(service, expected[service.ID]) {
+			t.Fatalf("bad service: %#v", service)
+		}
+	}
+}
+
+func TestResolverLookup_notFound(t *testing.T) {
+	addr, stop := testServer(t)
+	defer stop()
+
+	r := &Resolver{Domain: "example.com", Server: addr}
+	services, err := r.Lookup("mongodb")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(services) != 0 {
+		t.Fatalf("expected no services, got %v", services)
+	}
+}
+
+func TestResolverLookup_noDomain(t *testing.T) {
+	r := &Resolver{}
+	if _, err := r.Lookup("mongodb"); err == nil {
+		t.Fatal("expected an error without a domain")
+	}
+}
+
+func TestResolverOptions(t *testing.T) {
+	cases := []struct {
+		name     string
+		records  []string
+		expected map[string][]string
+		err      bool
+	}{
+		{
+			name:     "none",
+			expected: map[string][]string{},
+		},
+		{
+			name: "options",
+			records: []string{
+				`example.com. 60 IN TXT "replicaSet=rs0&authSource=admin"`,
+			},
+			expected: map[string][]string{
+				"replicaSet": {"rs0"},
+				"authSource": {"admin"},
+			},
+		},
+		{
+			name: "split across strings",
+			records: []string{
+				`example.com. 60 IN TXT "replicaSet=rs0&" "authSource=admin"`,
+			},
+			expected: map[string][]string{
+				"replicaSet": {"rs0"},
+				"authSource": {"admin"},
+			},
+		},
+		{
+			name: "malformed",
+			records: []string{
+				`example.com. 60 IN TXT "replicaSet=rs0&authSource=%zz"`,
+			},
+			err: true,
+		},
+		{
+			name: "multiple records",
+			records: []string{
+				`example.com. 60 IN TXT "replicaSet=rs0"`,
+				`example.com. 60 IN TXT "authSource=admin"`,
+			},
+			err: true,
+		},
+	}
+
+	for _, tc := range cases {
+		addr, stop := testServer(t, tc.records...)
+		r := &Resolver{Domain: "example.com", Server: addr}
+		options, err := r.Options("mongodb")
+		stop()
+
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(map[string][]string(options), tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, options)
+		}
+	}
+}
+
+func TestResolverReadOnly(t *testing.T) {
+	r := &Resolver{Domain: "example.com"}
+	service := &discovery.Service{Addr: "db1.example.com", Port: 27017}
+	if err := r.Register("mongodb", service); err != discovery.ErrReadOnly {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+	if err := r.Deregister("mongodb", service); err != discovery.ErrReadOnly {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+}
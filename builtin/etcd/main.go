@@ -0,0 +1,203 @@
+package etcd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path"
+	"time"
+
+	"github.com/aocsolutions/mongoctl/discovery"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// DefaultPrefix is the key prefix registrations are stored under
+// if none is configured.
+const DefaultPrefix = "/mongoctl/services"
+
+// Agent registers services in etcd under <Prefix>/<name>/<id>. When
+// TTL is set each registration is attached to a lease which must be
+// kept alive with KeepAlive, otherwise it expires.
+type Agent struct {
+	Endpoints []string
+	Prefix    string
+	TTL       int64
+}
+
+// Service is the value stored for each registration.
+type Service struct {
+	ID      string            `json:"id"`
+	Address string            `json:"address"`
+	Port    int               `json:"port"`
+	Tags    []string          `json:"tags,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+func (c *Agent) getClient() (cl *clientv3.Client, err error) {
+	endpoints := c.Endpoints
+	if len(endpoints) == 0 {
+		endpoints = []string{"127.0.0.1:2379"}
+	}
+	return clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: 5 * time.Second,
+	})
+}
+
+func (c *Agent) prefix(name string) string {
+	prefix := c.Prefix
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	return path.Join(prefix, name) + "/"
+}
+
+func (c *Agent) AddService(addr, id, name string, port int) (err error) {
+	return c.put(name, &Service{
+		ID:      id,
+		Address: addr,
+		Port:    port,
+	})
+}
+
+func (c *Agent) put(name string, service *Service) (err error) {
+	client, err := c.getClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	value, err := json.Marshal(service)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var opts []clientv3.OpOption
+	if c.TTL > 0 {
+		lease, err := client.Grant(ctx, c.TTL)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, clientv3.WithLease(lease.ID))
+	}
+
+	_, err = client.Put(ctx, c.prefix(name)+service.ID, string(value), opts...)
+	return err
+}
+
+func (c *Agent) RemoveService(name, id string) (err error) {
+	client, err := c.getClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = client.Delete(ctx, c.prefix(name)+id)
+	return err
+}
+
+func (c *Agent) GetService(name string) (nodes []*Service, err error) {
+	nodes, err = c.list(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		return nil, errors.New("No nodes found for service")
+	}
+	return nodes, nil
+}
+
+func (c *Agent) list(name string) (nodes []*Service, err error) {
+	client, err := c.getClient()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	resp, err := client.Get(ctx, c.prefix(name), clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	for _, kv := range resp.Kvs {
+		service := &Service{}
+		if err := json.Unmarshal(kv.Value, service); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, service)
+	}
+	return nodes, nil
+}
+
+// KeepAlive refreshes the lease of the registration with the given id
+// until ctx is cancelled. It is a no-op if TTL is not set.
+func (c *Agent) KeepAlive(ctx context.Context, name, id string) (err error) {
+	if c.TTL <= 0 {
+		return nil
+	}
+
+	client, err := c.getClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	resp, err := client.Get(ctx, c.prefix(name)+id)
+	if err != nil {
+		return err
+	}
+	if len(resp.Kvs) == 0 || resp.Kvs[0].Lease == 0 {
+		return errors.New("Service is not registered with a lease")
+	}
+
+	ch, err := client.KeepAlive(ctx, clientv3.LeaseID(resp.Kvs[0].Lease))
+	if err != nil {
+		return err
+	}
+	for range ch {
+	}
+	if ctx.Err() == nil {
+		return errors.New("Lease keep alive stopped")
+	}
+	return nil
+}
+
+// Lookup implements discovery.Discovery.
+func (c *Agent) Lookup(name string) (services []*discovery.Service, err error) {
+	nodes, err := c.list(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range nodes {
+		services = append(services, &discovery.Service{
+			ID:   node.ID,
+			Addr: node.Address,
+			Port: node.Port,
+			Tags: node.Tags,
+			Meta: node.Meta,
+		})
+	}
+	return services, nil
+}
+
+// Register implements discovery.Discovery.
+func (c *Agent) Register(name string, service *discovery.Service) error {
+	return c.put(name, &Service{
+		ID:      service.ID,
+		Address: service.Addr,
+		Port:    service.Port,
+		Tags:    service.Tags,
+		Meta:    service.Meta,
+	})
+}
+
+// Deregister implements discovery.Discovery.
+func (c *Agent) Deregister(name string, service *discovery.Service) error {
+	return c.RemoveService(name, service.ID)
+}
@@ -0,0 +1,176 @@
+package inventory
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+
+	"github.com/aocsolutions/mongoctl/discovery"
+	"github.com/hashicorp/hcl"
+	"github.com/mitchellh/go-homedir"
+)
+
+// Inventory is a static description of clusters, read from an HCL or
+// JSON file such as:
+//
+//	cluster "mongodb" {
+//	  seeds = ["10.0.0.1:27017"]
+//
+//	  member "10.0.0.1:27017" {}
+//	  member "10.0.0.2:27017" {}
+//	  member "10.0.0.3:27017" {
+//	    role = "arbiter"
+//	  }
+//	}
+type Inventory struct {
+	Clusters []*Cluster `hcl:"cluster"`
+}
+
+// Cluster is a single replica set in the inventory.
+type Cluster struct {
+	Name string `hcl:",key"`
+
+	// Seeds are the hosts used to connect to the cluster. The first
+	// seed is the member which initializes the replica set.
+	Seeds []string `hcl:"seeds"`
+
+	// Members are the hosts expected to be part of the cluster.
+	Members []*Member `hcl:"member"`
+}
+
+// Member is an expected member of a cluster.
+type Member struct {
+	Host string `hcl:",key"`
+
+	// Role is one of "arbiter" or "hidden", or empty for a regular
+	// data bearing member.
+	Role string `hcl:"role"`
+}
+
+// LoadInventory reads the inventory at path.
+func LoadInventory(path string) (*Inventory, error) {
+	path, err := homedir.Expand(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error expanding inventory path: %s", err)
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := hcl.Parse(string(contents))
+	if err != nil {
+		return nil, err
+	}
+
+	var inventory Inventory
+	if err := hcl.DecodeObject(&inventory, obj); err != nil {
+		return nil, err
+	}
+	return &inventory, nil
+}
+
+// Cluster returns the cluster with the given name, or nil.
+func (i *Inventory) Cluster(name string) *Cluster {
+	for _, cluster := range i.Clusters {
+		if cluster.Name == name {
+			return cluster
+		}
+	}
+	return nil
+}
+
+// File is a read only discovery backend backed by an inventory file.
+// The file is read on every lookup so that it can be edited between
+// runs of a long lived process.
+type File struct {
+	Path string
+}
+
+// Lookup implements discovery.Discovery. The seeds of the cluster are
+// returned first, followed by any other members, so that the first
+// service can be used to connect to the cluster.
+func (f *File) Lookup(name string) (services []*discovery.Service, err error) {
+	inventory, err := LoadInventory(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	cluster := inventory.Cluster(name)
+	if cluster == nil {
+		return nil, nil
+	}
+
+	roles := make(map[string]string)
+	for _, member := range cluster.Members {
+		roles[member.Host] = member.Role
+	}
+
+	seen := make(map[string]bool)
+	hosts := append(append([]string{}, cluster.Seeds...), memberHosts(cluster)...)
+	for _, host := range hosts {
+		if seen[host] {
+			continue
+		}
+		seen[host] = true
+
+		service, err := parseHost(host)
+		if err != nil {
+			return nil, err
+		}
+		if role := roles[host]; role != "" {
+			service.Tags = []string{role}
+		}
+		services = append(services, service)
+	}
+	return services, nil
+}
+
+// Seed implements discovery.Seeder by returning the first seed of
+// the cluster.
+func (f *File) Seed(name string) (*discovery.Service, error) {
+	inventory, err := LoadInventory(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	cluster := inventory.Cluster(name)
+	if cluster == nil || len(cluster.Seeds) == 0 {
+		return nil, nil
+	}
+	return parseHost(cluster.Seeds[0])
+}
+
+// Register is not supported, the inventory is edited by hand.
+func (f *File) Register(name string, service *discovery.Service) error {
+	return discovery.ErrReadOnly
+}
+
+// Deregister is not supported, the inventory is edited by hand.
+func (f *File) Deregister(name string, service *discovery.Service) error {
+	return discovery.ErrReadOnly
+}
+
+func memberHosts(cluster *Cluster) []string {
+	hosts := make([]string, 0, len(cluster.Members))
+	for _, member := range cluster.Members {
+		hosts = append(hosts, member.Host)
+	}
+	return hosts
+}
+
+func parseHost(host string) (*discovery.Service, error) {
+	addr, portStr, err := net.SplitHostPort(host)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid host %s in inventory: %s", host, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid port in host %s in inventory", host)
+	}
+	return &discovery.Service{
+		ID:   host,
+		Addr: addr,
+		Port: port,
+	}, nil
+}
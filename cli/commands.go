@@ -53,5 +53,60 @@ func Commands(metaPtr *command.Meta) map[string]cli.CommandFactory {
 				Meta: meta,
 			}, nil
 		},
+		"plan": func() (cli.Command, error) {
+			return &command.PlanCommand{
+				Meta: meta,
+			}, nil
+		},
+		"apply": func() (cli.Command, error) {
+			return &command.ApplyCommand{
+				Meta: meta,
+			}, nil
+		},
+		"member set": func() (cli.Command, error) {
+			return &command.MemberSetCommand{
+				Meta: meta,
+			}, nil
+		},
+		"stepdown": func() (cli.Command, error) {
+			return &command.StepDownCommand{
+				Meta: meta,
+			}, nil
+		},
+		"freeze": func() (cli.Command, error) {
+			return &command.FreezeCommand{
+				Meta: meta,
+			}, nil
+		},
+		"elect": func() (cli.Command, error) {
+			return &command.ElectCommand{
+				Meta: meta,
+			}, nil
+		},
+		"rolling": func() (cli.Command, error) {
+			return &command.RollingCommand{
+				Meta: meta,
+			}, nil
+		},
+		"check": func() (cli.Command, error) {
+			return &command.CheckCommand{
+				Meta: meta,
+			}, nil
+		},
+		"exporter": func() (cli.Command, error) {
+			return &command.ExporterCommand{
+				Meta: meta,
+			}, nil
+		},
+		"agent": func() (cli.Command, error) {
+			return &command.AgentCommand{
+				Meta: meta,
+			}, nil
+		},
+		"sync": func() (cli.Command, error) {
+			return &command.SyncCommand{
+				Meta: meta,
+			}, nil
+		},
 	}
 }
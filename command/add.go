@@ -3,11 +3,9 @@ package command
 import (
 	"fmt"
 	"strings"
-	"time"
 
-	"github.com/nevins-b/commgo"
-	"gopkg.in/mgo.v2"
-	"gopkg.in/mgo.v2/bson"
+	"github.com/aocsolutions/mongoctl/discovery"
+	"github.com/aocsolutions/mongoctl/replset"
 )
 
 type AddCommand struct {
@@ -15,18 +13,17 @@ type AddCommand struct {
 }
 
 func (c *AddCommand) Run(args []string) int {
-	var priority, port int
-	var hidden, arbitrator, ec2 bool
+	var port int
+	var ec2 bool
 	var addr, username string
-	flags := c.Meta.FlagSet("add", FlagSetDefault)
+	var member memberFlags
+	flags := c.Meta.FlagSet("add", FlagSetDefault|FlagSetDryRun)
 	flags.Usage = func() { c.Ui.Error(c.Help()) }
-	flags.IntVar(&priority, "priority", 1, "")
 	flags.IntVar(&port, "port", 27017, "")
 	flags.StringVar(&addr, "addr", "", "")
 	flags.StringVar(&username, "username", "", "")
-	flags.BoolVar(&hidden, "hidden", false, "")
-	flags.BoolVar(&arbitrator, "arbitrator", false, "")
 	flags.BoolVar(&ec2, "ec2", false, "")
+	member.register(flags)
 	if err := flags.Parse(args); err != nil {
 		return 1
 	}
@@ -40,6 +37,12 @@ func (c *AddCommand) Run(args []string) int {
 		addr = ip
 	}
 
+	host := fmt.Sprintf("%s:%d", addr, port)
+	if err := replset.ValidateMember(member.host(0, host)); err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+
 	node, err := c.Meta.GetNode()
 	if err != nil {
 		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
@@ -47,99 +50,70 @@ func (c *AddCommand) Run(args []string) int {
 	}
 
 	c.Ui.Info(fmt.Sprintf("Adding %s:%d to Cluster %s", addr, port, node))
-	info := &mgo.DialInfo{
-		Addrs:    []string{node},
-		Timeout:  5 * time.Second,
-		Username: username,
-	}
-
-	if len(username) > 0 {
-		info.Password, _ = c.Ui.Ask("Password: ")
-	}
-	session, err := mgo.DialWithInfo(info)
+	client, err := c.Meta.Client(username, false)
 	if err != nil {
 		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
 		return 1
 	}
+	defer client.Close()
 
-	defer session.Close()
-
-	config := &commgo.RsConf{}
-	conn := session.DB("local").C("system.replset")
-	count, err := conn.Count()
-	if count > 1 {
-		c.Ui.Error("Error: local.system.replset has unexpected contents")
-		return 1
-	}
-	err = conn.Find(bson.M{}).One(&config)
+	config, err := client.GetConfig()
 	if err != nil {
 		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
 		return 1
 	}
 
-	var max int64
-	max = 0
-	host := fmt.Sprintf("%s:%d", addr, port)
-	exists := false
-	for _, member := range config.Members {
-		if member.ID > max {
-			max = member.ID
-			if member.Host == host {
-				exists = true
-				break
-			}
-		}
-	}
-
-	if !exists {
-		config.Version++
-
-		cfg := &commgo.Host{
-			ID:          max + 1,
-			Host:        fmt.Sprintf("%s:%d", addr, port),
-			ArbiterOnly: arbitrator,
-		}
+	out := newChangeOutput(config, c.Meta.dryRun)
+	if replset.FindMember(config, host) < 0 {
+		cfg := member.host(replset.NextID(config), host)
 
 		config.Members = append(config.Members, cfg)
-
-		cmd := &bson.M{
-			"replSetReconfig": config,
+		if err := replset.ValidateConfig(config); err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+			return 1
 		}
-		result := bson.M{}
-		if err := session.DB("admin").Run(&cmd, &result); err != nil {
+
+		if err := client.Reconfig(config); err != nil {
 			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
 			return 1
 		}
+		out.Version = config.Version
+		out.Added = append(out.Added, host)
 	}
 
-	if c.Meta.consul {
-		registered, err := c.Meta.consulAgent.GetService(c.Meta.consulKey, "")
+	d, err := c.Meta.Discovery()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+	if d != nil {
+		registered, err := d.Lookup(c.Meta.serviceName)
 		if err != nil {
 			c.Ui.Error(err.Error())
 			return 1
 		}
-		found := false
-		for _, node := range registered {
-			if node.Address == host && node.ServicePort == port {
-				found = true
-				break
+		if discovery.Find(registered, addr, port) == nil {
+			service := &discovery.Service{
+				ID:   host,
+				Addr: addr,
+				Port: port,
 			}
-		}
-		if !found {
-			err := c.Meta.consulAgent.AddService(
-				addr,
-				fmt.Sprintf("%s:%d", addr, port),
-				fmt.Sprintf("/bin/nc -zv %s %d", addr, port),
-				"mongodb",
-				port,
-			)
+			// Tag the registration with the role of the member, which
+			// is only known from its configuration until it has joined.
+			if status, err := client.Status(); err == nil {
+				c.Meta.describe(service, config, status)
+			}
+			ok, err := c.Meta.register(d, service)
 			if err != nil {
 				c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
 				return 1
 			}
+			if ok {
+				out.Registered = append(out.Registered, service.ID)
+			}
 		}
 	}
-	return 0
+	return c.Meta.output(out)
 }
 
 func (c *AddCommand) Help() string {
@@ -151,14 +125,7 @@ Usage: mongoctl add [options]
   the added host to the Mongo service in consul.
 
 General Options:
-  -mongo=addr             The address of the Mongo server if not using Consul.
-
-  -consul-service=service The service name to use when looking up Mongo
-                          with consul.
-
-  -consul-server=addr     The address of the consul server to use,
-                          this defaults to 127.0.0.1:8500.
-  -consul                 Use consul to find Mongo
+  ` + generalOptionsUsage() + `
 
 Init Options:
 
@@ -169,19 +136,14 @@ Init Options:
   -port=port              The port of the host to add.
                           Defaults to 27017.
 
-  -priority=priority      The priority of the host to add.
-                          Defaults to 1.
-
-  -hidden                 If the host should be added hidden.
-                          Defaults to False.
-
-  -arbitrator             If the host should be added as an arbitrator.
-                          Defaults to False.
+  ` + memberOptionsUsage() + `
 
   -ec2                    If the host to be added is an EC2 instance.
                           This can be used to discover the address of the
                           instance to add, assuming the command is run on the
 													instance that is being added.
+
+  ` + dryRunOptionsUsage() + `
 `
 	return strings.TrimSpace(helpText)
 }
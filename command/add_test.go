@@ -0,0 +1,96 @@
+package command
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aocsolutions/mongoctl/replset"
+)
+
+func TestAddCommand(t *testing.T) {
+	client, d := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+	)
+	meta, ui := testMeta(client, d)
+	c := &AddCommand{Meta: meta}
+
+	if code := c.Run([]string{"-addr", "10.0.0.3", "-hidden", "-tag", "dc=east"}); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+
+	if len(client.Reconfigs) != 1 {
+		t.Fatalf("expected one reconfig, got %d", len(client.Reconfigs))
+	}
+	added := client.Config.Members[2]
+	if added.Host != "10.0.0.3:27017" || added.ID != 2 {
+		t.Fatalf("bad member: %#v", added)
+	}
+	if !added.Hidden || added.Priority != 0 || added.Tags["dc"] != "east" {
+		t.Fatalf("member flags not applied: %#v", added)
+	}
+
+	services, _ := d.Lookup("mongodb")
+	service := services[len(services)-1]
+	if service.ID != "10.0.0.3:27017" || service.Addr != "10.0.0.3" || service.Port != 27017 {
+		t.Fatalf("bad registration: %#v", service)
+	}
+	if !service.HasTag("hidden") || service.Meta["replica_set"] != "rs0" {
+		t.Fatalf("registration not described: %#v", service)
+	}
+}
+
+func TestAddCommand_existing(t *testing.T) {
+	client, d := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+	)
+	meta, ui := testMeta(client, d)
+	c := &AddCommand{Meta: meta}
+
+	if code := c.Run([]string{"-addr", "10.0.0.2"}); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+	if len(client.Reconfigs) != 0 {
+		t.Fatalf("expected no reconfig, got %d", len(client.Reconfigs))
+	}
+	if ids := d.ids("mongodb"); len(ids) != 2 {
+		t.Fatalf("expected no new registration, got %v", ids)
+	}
+}
+
+func TestAddCommand_invalid(t *testing.T) {
+	cases := [][]string{
+		{"-addr", "10.0.0.3", "-hidden", "-priority", "1"},
+		{"-addr", "10.0.0.3", "-arbitrator", "-priority", "1"},
+		{"-addr", "10.0.0.3", "-votes", "2"},
+	}
+	for _, args := range cases {
+		client, d := testSet(testMember{"10.0.0.1:27017", replset.StatePrimary, 1})
+		meta, _ := testMeta(client, d)
+		c := &AddCommand{Meta: meta}
+
+		if code := c.Run(args); code != 1 {
+			t.Errorf("%v: expected failure, got %d", args, code)
+		}
+		if len(client.Reconfigs) != 0 {
+			t.Errorf("%v: expected no reconfig", args)
+		}
+	}
+}
+
+func TestAddCommand_dryRun(t *testing.T) {
+	client, d := testSet(testMember{"10.0.0.1:27017", replset.StatePrimary, 1})
+	meta, ui := testMeta(client, d)
+	c := &AddCommand{Meta: meta}
+
+	if code := c.Run([]string{"-addr", "10.0.0.2", "-dry-run"}); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+	if len(client.Reconfigs) != 0 {
+		t.Fatalf("expected no reconfig, got %d", len(client.Reconfigs))
+	}
+	if ids := d.ids("mongodb"); !reflect.DeepEqual(ids, []string{"10.0.0.1:27017"}) {
+		t.Fatalf("expected no new registration, got %v", ids)
+	}
+}
@@ -0,0 +1,386 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/aocsolutions/mongoctl/discovery"
+	"github.com/aocsolutions/mongoctl/replset"
+	"github.com/nevins-b/commgo"
+)
+
+// agentFlagNames are the flags only understood by the agent, stripped
+// from the arguments passed on to initoradd and add.
+var agentFlagNames = []string{"interval", "leave", "timeout", "http"}
+
+type AgentCommand struct {
+	Meta
+}
+
+// agent is the state kept by a running agent.
+type agent struct {
+	self *discovery.Service
+	args []string
+
+	// registered is set once the agent has registered the member, with
+	// the roles it was tagged with.
+	registered bool
+	roles      []string
+
+	// stopKeepAlive stops refreshing the current registration.
+	stopKeepAlive context.CancelFunc
+
+	// lock guards health, which is served by the health endpoint.
+	lock   sync.Mutex
+	health agentHealth
+}
+
+// agentHealth is the state of the member as of the last sync.
+type agentHealth struct {
+	Member  string    `json:"member"`
+	State   string    `json:"state"`
+	Healthy bool      `json:"healthy"`
+	Roles   []string  `json:"roles"`
+	Error   string    `json:"error,omitempty"`
+	Checked time.Time `json:"checked"`
+}
+
+// setHealth records the state of the member from status, or err if
+// the state couldn't be read.
+func (a *agent) setHealth(status *commgo.RsStatus, roles []string, err error) {
+	health := agentHealth{
+		Member:  a.self.String(),
+		Roles:   roles,
+		Checked: time.Now(),
+	}
+	if err != nil {
+		health.Error = err.Error()
+	} else if stats := replset.FindStats(status, a.self.String()); stats != nil {
+		health.State = stats.StateStr
+		health.Healthy = replset.Healthy(stats)
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.health = health
+}
+
+// ServeHTTP answers with the health of the member as of the last sync,
+// 200 if it is healthy and 503 otherwise, for use by Consul http checks
+// and load balancers.
+func (a *agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.lock.Lock()
+	health := a.health
+	a.lock.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !health.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(health)
+}
+
+func (c *AgentCommand) Run(args []string) int {
+	var port int
+	var ec2, leave bool
+	var addr, username, httpAddr string
+	var lockWait, interval, timeout time.Duration
+	var member memberFlags
+	flags := c.Meta.FlagSet("agent", FlagSetDefault)
+	flags.Usage = func() { c.Ui.Error(c.Help()) }
+	flags.IntVar(&port, "port", 27017, "")
+	flags.StringVar(&addr, "addr", "", "")
+	flags.StringVar(&username, "username", "", "")
+	flags.BoolVar(&ec2, "ec2", false, "")
+	member.register(flags)
+	flags.DurationVar(&lockWait, "lock-wait", 30*time.Second, "")
+	flags.DurationVar(&interval, "interval", 30*time.Second, "")
+	flags.BoolVar(&leave, "leave", true, "")
+	flags.DurationVar(&timeout, "timeout", 2*time.Minute, "")
+	flags.StringVar(&httpAddr, "http", "", "")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if len(addr) == 0 && ec2 {
+		ip, err := c.Meta.GetLocalIP()
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+			return 1
+		}
+		addr = ip
+	}
+	if len(addr) == 0 {
+		c.Ui.Error("Error: the address of this member must be given with -addr or -ec2")
+		return 1
+	}
+
+	d, err := c.Meta.Discovery()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+	if d == nil {
+		c.Ui.Error("Error: agent requires a discovery backend")
+		return 1
+	}
+
+	a := &agent{
+		self: &discovery.Service{
+			ID:   fmt.Sprintf("%s:%d", addr, port),
+			Addr: addr,
+			Port: port,
+		},
+		args: filterArgs(args, agentFlagNames...),
+	}
+	defer a.keepAlive(nil, "")
+
+	if len(httpAddr) > 0 {
+		mux := http.NewServeMux()
+		mux.Handle("/health", a)
+		server := &http.Server{Addr: httpAddr, Handler: mux}
+		go func() {
+			if err := server.ListenAndServe(); err != http.ErrServerClosed {
+				c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+			}
+		}()
+		defer server.Close()
+	}
+
+	// Join the set just as initoradd would at boot
+	initOrAdd := &InitOrAddCommand{
+		Meta: c.Meta,
+	}
+	if code := initOrAdd.Run(a.args); code != 0 {
+		return code
+	}
+
+	client, err := c.Meta.Client(username, false)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+	defer client.Close()
+
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signalCh)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// Errors are expected while the set elects a primary, so
+		// report them and try again on the next tick.
+		if err := c.sync(client, d, a); err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		}
+
+		select {
+		case sig := <-signalCh:
+			c.Ui.Info(fmt.Sprintf("Received %s, shutting down", sig))
+			if !leave {
+				return 0
+			}
+			return c.leave(client, d, a, timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// sync makes sure this member is part of the set and that its
+// registration is tagged with its current role. A member which has
+// been removed from the set, such as by clean after an outage, is
+// added back.
+func (c *AgentCommand) sync(client replset.Client, d discovery.Discovery, a *agent) error {
+	config, err := client.GetConfig()
+	if err != nil {
+		a.setHealth(nil, nil, err)
+		return err
+	}
+	i := replset.FindMember(config, a.self.String())
+	if i < 0 {
+		c.Ui.Info(fmt.Sprintf("%s is not a member of the set, adding it", a.self))
+		add := &AddCommand{
+			Meta: c.Meta,
+		}
+		if code := add.Run(filterArgs(a.args, "lock-wait")); code != 0 {
+			err := fmt.Errorf("Failed to add %s to the set", a.self)
+			a.setHealth(nil, nil, err)
+			return err
+		}
+		a.registered = false
+		return nil
+	}
+
+	status, err := client.Status()
+	if err != nil {
+		a.setHealth(nil, nil, err)
+		return err
+	}
+	service := *a.self
+	c.Meta.describe(&service, config, status)
+	a.setHealth(status, service.Tags, nil)
+
+	registered, err := d.Lookup(c.Meta.serviceName)
+	if err != nil {
+		return err
+	}
+	if a.registered && equalRoles(a.roles, service.Tags) && discovery.Find(registered, a.self.Addr, a.self.Port) != nil {
+		return nil
+	}
+
+	c.Ui.Info(fmt.Sprintf("Registering %s with role %s", a.self, strings.Join(service.Tags, ",")))
+	if _, err := c.Meta.register(d, &service); err != nil {
+		return err
+	}
+	a.registered = true
+	a.roles = service.Tags
+	a.keepAlive(d, c.Meta.serviceName)
+	return nil
+}
+
+// keepAlive refreshes the registration of the agent if the backend
+// needs it, replacing any previous refresh. With no backend it only
+// stops the previous refresh.
+func (a *agent) keepAlive(d discovery.Discovery, name string) {
+	if a.stopKeepAlive != nil {
+		a.stopKeepAlive()
+		a.stopKeepAlive = nil
+	}
+	keeper, ok := d.(discovery.KeepAliver)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.stopKeepAlive = cancel
+	go keeper.KeepAlive(ctx, name, a.self.ID)
+}
+
+// leave deregisters this member and removes it from the set, stepping
+// it down first if it is the primary.
+func (c *AgentCommand) leave(client replset.Client, d discovery.Discovery, a *agent, timeout time.Duration) int {
+	a.keepAlive(nil, "")
+	c.Ui.Info(fmt.Sprintf("Deregistering %s", a.self))
+	if _, err := c.Meta.deregister(d, a.self); err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+	}
+
+	status, err := client.Status()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+	if primary := replset.Primary(status); primary != nil && primary.Name == a.self.String() {
+		c.Ui.Info(fmt.Sprintf("Stepping down %s", a.self))
+		if err := client.StepDown(int(timeout/time.Second), 10); err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+			return 1
+		}
+		_, err := replset.WaitForPrimaryOf(client, func(m *commgo.RsMemberStats) bool {
+			return m.Name != a.self.String()
+		}, timeout)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+			return 1
+		}
+		if status, err = client.Status(); err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+			return 1
+		}
+	}
+
+	config, err := client.GetConfig()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+	if replset.FindMember(config, a.self.String()) < 0 {
+		return 0
+	}
+	if !c.Meta.checkRemove(config, status, false, a.self.String()) {
+		return 1
+	}
+
+	c.Ui.Info(fmt.Sprintf("Removing %s from the set", a.self))
+	replset.RemoveMember(config, a.self.String())
+	if err := client.Reconfig(config); err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+	return 0
+}
+
+// equalRoles returns whether a and b hold the same roles in order.
+func equalRoles(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *AgentCommand) Help() string {
+	helpText := `
+Usage: mongoctl agent [options]
+  Run beside a Mongo server to keep it in the Replica Set.
+  This command joins the set as initoradd does, then keeps running. It
+  registers the member with a discovery backend tagged with its current
+  role, updating the registration when the role changes, and adds the
+  member back if it is removed from the set. On SIGTERM or interrupt it
+  deregisters the member, steps it down if it is primary and removes it
+  from the set.
+
+General Options:
+  ` + generalOptionsUsage() + `
+
+Agent Options:
+
+  -username=username      The username to authenticate with if required.
+
+  -addr=addr              The address of this member.
+
+  -port=port              The port of this member.
+                          Defaults to 27017.
+
+  ` + memberOptionsUsage() + `
+
+  -ec2                    Discover the address of this member from the
+                          EC2 instance metadata.
+
+  -lock-wait=duration     How long to wait for the cluster lock when the
+                          discovery backend supports locking.
+                          Defaults to 30s.
+
+  -interval=duration      How often to check the role and membership of
+                          this member. Defaults to 30s.
+
+  -leave=false            Keep the member in the set and registered when
+                          the agent exits. Defaults to true.
+
+  -timeout=duration       How long to wait for a new primary when
+                          stepping down on exit. Defaults to 2m.
+
+  -http=addr              Serve the health of this member on addr under
+                          /health, 200 when it is healthy and 503
+                          otherwise. Use it with -consul-check=http.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *AgentCommand) Synopsis() string {
+	return "Run beside a Mongo server to keep it registered and in the set"
+}
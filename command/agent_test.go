@@ -0,0 +1,175 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/aocsolutions/mongoctl/discovery"
+	"github.com/aocsolutions/mongoctl/replset"
+)
+
+// testAgent returns the state of an agent for the member host:port,
+// as Run would set it up. Since sync and leave are called directly
+// rather than through Run, tests set the service name on the Meta.
+func testAgent(host string, port int, args ...string) *agent {
+	return &agent{
+		self: &discovery.Service{
+			ID:   fmt.Sprintf("%s:%d", host, port),
+			Addr: host,
+			Port: port,
+		},
+		args: args,
+	}
+}
+
+func TestAgentCommand_sync(t *testing.T) {
+	client, d := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+		testMember{"10.0.0.3:27017", replset.StateSecondary, 1},
+	)
+	meta, ui := testMeta(client, d)
+	meta.serviceName = "mongodb"
+	c := &AgentCommand{Meta: meta}
+	a := testAgent("10.0.0.2", 27017)
+
+	if err := c.sync(client, d, a); err != nil {
+		t.Fatalf("err: %s\n\n%s", err, ui.ErrorWriter.String())
+	}
+	if !a.registered || !reflect.DeepEqual(a.roles, []string{"secondary"}) {
+		t.Fatalf("expected the member to be registered as secondary, got %v", a.roles)
+	}
+
+	// The registration follows the role of the member.
+	client.StepDown(60, 10)
+	status, _ := client.Status()
+	if primary := replset.Primary(status); primary == nil || primary.Name != "10.0.0.2:27017" {
+		t.Fatalf("expected 10.0.0.2:27017 to be elected, got %v", primary)
+	}
+	if err := c.sync(client, d, a); err != nil {
+		t.Fatalf("err: %s\n\n%s", err, ui.ErrorWriter.String())
+	}
+
+	services, _ := d.Lookup("mongodb")
+	self := discovery.Find(services, "10.0.0.2", 27017)
+	if self == nil || !reflect.DeepEqual(self.Tags, []string{"primary"}) {
+		t.Fatalf("expected the registration to be tagged primary, got %#v", self)
+	}
+	if len(services) != 3 {
+		t.Fatalf("expected one registration per member, got %v", d.ids("mongodb"))
+	}
+}
+
+func TestAgentCommand_syncRemoved(t *testing.T) {
+	client, d := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+		testMember{"10.0.0.3:27017", replset.StateSecondary, 1},
+	)
+	meta, ui := testMeta(client, d)
+	meta.serviceName = "mongodb"
+	c := &AgentCommand{Meta: meta}
+	a := testAgent("10.0.0.4", 27017, "-addr", "10.0.0.4")
+	a.registered = true
+
+	if err := c.sync(client, d, a); err != nil {
+		t.Fatalf("err: %s\n\n%s", err, ui.ErrorWriter.String())
+	}
+	if replset.FindMember(client.Config, "10.0.0.4:27017") < 0 {
+		t.Fatalf("expected the member to be added back, got %v", hosts(client.Config))
+	}
+	if a.registered {
+		t.Fatalf("expected the registration to be refreshed on the next sync")
+	}
+}
+
+func TestAgentCommand_leave(t *testing.T) {
+	client, d := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+		testMember{"10.0.0.3:27017", replset.StateSecondary, 1},
+	)
+	meta, ui := testMeta(client, d)
+	meta.serviceName = "mongodb"
+	c := &AgentCommand{Meta: meta}
+	a := testAgent("10.0.0.1", 27017)
+
+	if code := c.leave(client, d, a, 0); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+
+	expected := []string{"10.0.0.2:27017", "10.0.0.3:27017"}
+	if actual := hosts(client.Config); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected members %v, got %v", expected, actual)
+	}
+	if actual := d.ids("mongodb"); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected registrations %v, got %v", expected, actual)
+	}
+}
+
+func TestAgentCommand_leaveUnsafe(t *testing.T) {
+	client, d := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+		testMember{"10.0.0.3:27017", replset.StateDown, 1},
+		testMember{"10.0.0.4:27017", replset.StateDown, 1},
+	)
+	meta, _ := testMeta(client, d)
+	meta.serviceName = "mongodb"
+	c := &AgentCommand{Meta: meta}
+	a := testAgent("10.0.0.2", 27017)
+
+	if code := c.leave(client, d, a, 0); code != 1 {
+		t.Fatalf("expected failure, got %d", code)
+	}
+	if len(client.Reconfigs) != 0 {
+		t.Fatalf("expected no reconfig, got %d", len(client.Reconfigs))
+	}
+}
+
+func TestAgentCommand_noDiscovery(t *testing.T) {
+	client, _ := testSet(testMember{"10.0.0.1:27017", replset.StatePrimary, 1})
+	meta, _ := testMeta(client, nil)
+	c := &AgentCommand{Meta: meta}
+
+	if code := c.Run([]string{"-addr", "10.0.0.1"}); code != 1 {
+		t.Fatalf("expected failure without a discovery backend, got %d", code)
+	}
+}
+
+func TestAgentHealth(t *testing.T) {
+	client, _ := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateRecovering, 1},
+	)
+	status, _ := client.Status()
+
+	cases := []struct {
+		host string
+		code int
+	}{
+		{"10.0.0.1", 200},
+		{"10.0.0.2", 503},
+	}
+
+	for _, tc := range cases {
+		a := testAgent(tc.host, 27017)
+		a.setHealth(status, nil, nil)
+
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+		if w.Code != tc.code {
+			t.Errorf("%s: expected %d, got %d", tc.host, tc.code, w.Code)
+		}
+		var health agentHealth
+		if err := json.Unmarshal(w.Body.Bytes(), &health); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if health.Member != a.self.String() {
+			t.Errorf("%s: bad health: %#v", tc.host, health)
+		}
+	}
+}
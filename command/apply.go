@@ -0,0 +1,137 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aocsolutions/mongoctl/replset"
+)
+
+type ApplyCommand struct {
+	Meta
+}
+
+func (c *ApplyCommand) Run(args []string) int {
+	var file, username string
+	var yes, force bool
+	var timeout time.Duration
+	flags := c.Meta.FlagSet("apply", FlagSetDefault)
+	flags.Usage = func() { c.Ui.Error(c.Help()) }
+	flags.StringVar(&file, "f", "", "")
+	flags.StringVar(&username, "username", "", "")
+	flags.BoolVar(&yes, "yes", false, "")
+	flags.BoolVar(&force, "force", false, "")
+	flags.DurationVar(&timeout, "timeout", 2*time.Minute, "")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	plan, code := c.Meta.plan(file, username)
+	if plan == nil {
+		return code
+	}
+	c.Meta.outputPlan(plan)
+	out := newPlanOutput(plan)
+	out.Applied = true
+	if plan.Empty() {
+		return c.Meta.output(out)
+	}
+
+	if !yes {
+		ok, err := c.Meta.confirm("Apply these changes?")
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+			return 1
+		}
+		if !ok {
+			c.Ui.Info("Apply cancelled.")
+			return 1
+		}
+	}
+
+	client, err := c.Meta.Client(username, false)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+	defer client.Close()
+
+	for i, step := range plan.Steps {
+		c.Ui.Info(fmt.Sprintf("Step %d/%d: %s", i+1, len(plan.Steps), step.Description))
+
+		// Each reconfig bumps the version, so base every step on
+		// the version that is live now.
+		live, err := client.GetConfig()
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+			return 1
+		}
+		step.Config.Version = live.Version
+
+		// Check the set can take the step, members added by it count
+		// as unhealthy until they have joined.
+		status, err := client.Status()
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+			return 1
+		}
+		if _, err := replset.CheckReconfig(step.Config, status); err != nil {
+			if !force {
+				c.Ui.Error(fmt.Sprintf("Error: %s, use -force to apply anyway", err.Error()))
+				return 1
+			}
+			c.Ui.Error(fmt.Sprintf("Warning: %s, continuing because of -force", err.Error()))
+		}
+
+		if err := client.Reconfig(step.Config); err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+			return 1
+		}
+
+		// Don't start the next reconfig until the set has a primary
+		// to accept it.
+		if _, err := replset.WaitForPrimary(client, timeout); err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+			return 1
+		}
+	}
+
+	c.Ui.Info("Apply complete.")
+	return c.Meta.output(out)
+}
+
+func (c *ApplyCommand) Help() string {
+	helpText := `
+Usage: mongoctl apply -f cluster.hcl [options]
+  Change a Replica Set to match a spec.
+  This command computes the same plan as mongoctl plan, asks for
+  confirmation, and then runs each replSetReconfig in turn, waiting for
+  the set to have a primary between steps. A step is only applied while
+  the set has a primary and a majority of the voting members it would
+  have are healthy.
+
+General Options:
+  ` + generalOptionsUsage() + `
+
+Apply Options:
+
+  -f=path                 The spec file describing the replica set.
+
+  -username=username      The username to authenticate with if required.
+
+  -yes                    Apply without asking for confirmation.
+
+  -timeout=duration       How long to wait for a primary after each step.
+                          Defaults to 2m.
+
+  -force                  Apply a step even if the set has no primary or
+                          the healthy voting members of the new
+                          configuration would not be a majority.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *ApplyCommand) Synopsis() string {
+	return "Change a replica set to match a spec"
+}
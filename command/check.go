@@ -0,0 +1,278 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aocsolutions/mongoctl/replset"
+)
+
+// Exit codes of check, as expected by Nagios and Sensu.
+const (
+	CheckOK       = 0
+	CheckWarning  = 1
+	CheckCritical = 2
+	CheckUnknown  = 3
+)
+
+var checkStatus = map[int]string{
+	CheckOK:       "OK",
+	CheckWarning:  "WARNING",
+	CheckCritical: "CRITICAL",
+	CheckUnknown:  "UNKNOWN",
+}
+
+// checkSeverity orders the exit codes, CRITICAL outranks UNKNOWN which
+// outranks WARNING.
+var checkSeverity = map[int]int{
+	CheckOK:       0,
+	CheckWarning:  1,
+	CheckUnknown:  2,
+	CheckCritical: 3,
+}
+
+type CheckCommand struct {
+	Meta
+}
+
+// checkThresholds are the limits applied by check, a zero value
+// disables the check.
+type checkThresholds struct {
+	warnLag   time.Duration
+	critLag   time.Duration
+	warnOplog time.Duration
+	critOplog time.Duration
+}
+
+func (c *CheckCommand) Run(args []string) int {
+	var username string
+	var limits checkThresholds
+	flags := c.Meta.FlagSet("check", FlagSetDefault)
+	flags.Usage = func() { c.Ui.Error(c.Help()) }
+	flags.StringVar(&username, "username", "", "")
+	flags.DurationVar(&limits.warnLag, "warn-lag", 10*time.Second, "")
+	flags.DurationVar(&limits.critLag, "crit-lag", time.Minute, "")
+	flags.DurationVar(&limits.warnOplog, "warn-oplog-window", 24*time.Hour, "")
+	flags.DurationVar(&limits.critOplog, "crit-oplog-window", time.Hour, "")
+	if err := flags.Parse(args); err != nil {
+		return CheckUnknown
+	}
+
+	result := c.check(username, limits)
+	if c.Meta.output(result) != 0 {
+		return CheckUnknown
+	}
+	return result.Code
+}
+
+// check evaluates the health of the set. Failing to read the state of
+// the set is reported as UNKNOWN.
+func (c *CheckCommand) check(username string, limits checkThresholds) *checkOutput {
+	result := &checkOutput{
+		Status:   checkStatus[CheckOK],
+		Messages: []string{},
+		Perfdata: []perfdata{},
+	}
+
+	client, err := c.Meta.Client(username, false)
+	if err != nil {
+		result.raise(CheckUnknown, err.Error())
+		return result
+	}
+	defer client.Close()
+
+	config, err := client.GetConfig()
+	if err != nil {
+		result.raise(CheckUnknown, err.Error())
+		return result
+	}
+	status, err := client.Status()
+	if err != nil {
+		result.raise(CheckUnknown, err.Error())
+		return result
+	}
+	result.Set = status.Set
+
+	quorum := replset.NewQuorum(config, status)
+	if !quorum.HasMajority() {
+		result.raise(CheckCritical, fmt.Sprintf("majority lost, %s", quorum))
+	}
+
+	primary := replset.Primary(status)
+	if primary == nil {
+		result.raise(CheckCritical, "no primary")
+	}
+
+	healthy := 0
+	var maxLag time.Duration
+	for _, member := range status.Members {
+		if !replset.Healthy(member) {
+			result.raise(CheckWarning, fmt.Sprintf("%s is %s", member.Name, member.StateStr))
+			continue
+		}
+		healthy++
+
+		lag := replset.Lag(status, member)
+		if lag > maxLag {
+			maxLag = lag
+		}
+		switch {
+		case limits.critLag > 0 && lag > limits.critLag:
+			result.raise(CheckCritical, fmt.Sprintf("%s is %s behind the primary", member.Name, lag))
+		case limits.warnLag > 0 && lag > limits.warnLag:
+			result.raise(CheckWarning, fmt.Sprintf("%s is %s behind the primary", member.Name, lag))
+		}
+	}
+	result.perf("members", float64(len(status.Members)), "", 0, 0)
+	result.perf("healthy", float64(healthy), "", 0, 0)
+	result.perf("healthy_voters", float64(quorum.Healthy), "", 0, 0)
+	result.perf("max_lag", maxLag.Seconds(), "s", limits.warnLag, limits.critLag)
+
+	if primary != nil {
+		oplog, err := client.OplogWindow()
+		if err != nil {
+			result.raise(CheckUnknown, fmt.Sprintf("unable to read the oplog: %s", err))
+		} else {
+			window := oplog.Duration()
+			switch {
+			case limits.critOplog > 0 && window < limits.critOplog:
+				result.raise(CheckCritical, fmt.Sprintf("oplog window is %s", window))
+			case limits.warnOplog > 0 && window < limits.warnOplog:
+				result.raise(CheckWarning, fmt.Sprintf("oplog window is %s", window))
+			}
+			perf := result.perf("oplog_window", window.Seconds(), "s", limits.warnOplog, limits.critOplog)
+			perf.below = true
+		}
+	}
+
+	d, err := c.Meta.Discovery()
+	if err != nil {
+		result.raise(CheckUnknown, err.Error())
+		return result
+	}
+	if d != nil {
+		registered, err := d.Lookup(c.Meta.serviceName)
+		if err != nil {
+			result.raise(CheckUnknown, err.Error())
+			return result
+		}
+		unregistered, stale := registrationDrift(config, registered)
+		for _, host := range unregistered {
+			result.raise(CheckWarning, fmt.Sprintf("%s is not registered", host))
+		}
+		for _, service := range stale {
+			result.raise(CheckWarning, fmt.Sprintf("%s is registered but not a member", service))
+		}
+		result.perf("drift", float64(len(unregistered)+len(stale)), "", 0, 0)
+	}
+	return result
+}
+
+// checkOutput is the result of check.
+type checkOutput struct {
+	Set      string     `json:"set" yaml:"set"`
+	Status   string     `json:"status" yaml:"status"`
+	Code     int        `json:"code" yaml:"code"`
+	Messages []string   `json:"messages" yaml:"messages"`
+	Perfdata []perfdata `json:"perfdata" yaml:"perfdata"`
+}
+
+// perfdata is a single performance value of a check.
+type perfdata struct {
+	Label    string  `json:"label" yaml:"label"`
+	Value    float64 `json:"value" yaml:"value"`
+	Unit     string  `json:"unit" yaml:"unit"`
+	Warning  float64 `json:"warning" yaml:"warning"`
+	Critical float64 `json:"critical" yaml:"critical"`
+
+	// below is set when values under the thresholds are a problem.
+	below bool
+}
+
+// raise records a problem, keeping the most severe code seen.
+func (o *checkOutput) raise(code int, message string) {
+	o.Messages = append(o.Messages, message)
+	if checkSeverity[code] > checkSeverity[o.Code] {
+		o.Code = code
+		o.Status = checkStatus[code]
+	}
+}
+
+// perf records a performance value and returns it.
+func (o *checkOutput) perf(label string, value float64, unit string, warn, crit time.Duration) *perfdata {
+	o.Perfdata = append(o.Perfdata, perfdata{
+		Label:    label,
+		Value:    value,
+		Unit:     unit,
+		Warning:  warn.Seconds(),
+		Critical: crit.Seconds(),
+	})
+	return &o.Perfdata[len(o.Perfdata)-1]
+}
+
+// Table formats the result as a plugin output line with perfdata.
+func (o *checkOutput) Table() string {
+	summary := "replica set is healthy"
+	if len(o.Messages) > 0 {
+		summary = strings.Join(o.Messages, ", ")
+	}
+
+	var perf []string
+	for _, p := range o.Perfdata {
+		// A threshold of "n:" alerts when the value is below n.
+		format := "%g"
+		if p.below {
+			format = "%g:"
+		}
+		var warn, crit string
+		if p.Warning > 0 {
+			warn = fmt.Sprintf(format, p.Warning)
+		}
+		if p.Critical > 0 {
+			crit = fmt.Sprintf(format, p.Critical)
+		}
+		perf = append(perf, fmt.Sprintf("%s=%g%s;%s;%s;0", p.Label, p.Value, p.Unit, warn, crit))
+	}
+	return fmt.Sprintf("MONGODB %s - %s | %s", o.Status, summary, strings.Join(perf, " "))
+}
+
+func (c *CheckCommand) Help() string {
+	helpText := `
+Usage: mongoctl check [options]
+  Check the health of a Mongo Replica Set.
+  This command connects to a Mongo server and checks that the set has a
+  primary and a majority of healthy voters, that every member is healthy
+  and within the lag thresholds, that the oplog window of the primary is
+  long enough, and, with a discovery backend, that the registrations
+  match the members of the set. The result is printed as a monitoring
+  plugin line with perfdata and the exit code is 0 for OK, 1 for
+  WARNING, 2 for CRITICAL and 3 for UNKNOWN.
+
+General Options:
+  ` + generalOptionsUsage() + `
+
+Check Options:
+
+  -username=username      The username to authenticate with if required.
+
+  -warn-lag=duration      Warn when a member is further behind the primary
+                          than this. Defaults to 10s, 0 disables it.
+
+  -crit-lag=duration      Critical when a member is further behind the
+                          primary than this. Defaults to 1m, 0 disables it.
+
+  -warn-oplog-window=duration
+                          Warn when the oplog window of the primary is
+                          shorter than this. Defaults to 24h, 0 disables it.
+
+  -crit-oplog-window=duration
+                          Critical when the oplog window of the primary is
+                          shorter than this. Defaults to 1h, 0 disables it.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *CheckCommand) Synopsis() string {
+	return "Check the health of a replica set for monitoring"
+}
@@ -0,0 +1,154 @@
+package command
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aocsolutions/mongoctl/discovery"
+	"github.com/aocsolutions/mongoctl/replset"
+)
+
+func TestCheckCommand(t *testing.T) {
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name     string
+		members  []testMember
+		setup    func(*replset.Memory, *testDiscovery)
+		code     int
+		messages []string
+	}{
+		{
+			name: "healthy",
+			members: []testMember{
+				{"10.0.0.1:27017", replset.StatePrimary, 1},
+				{"10.0.0.2:27017", replset.StateSecondary, 1},
+				{"10.0.0.3:27017", replset.StateSecondary, 1},
+			},
+			code:     CheckOK,
+			messages: []string{},
+		},
+		{
+			name: "lag",
+			members: []testMember{
+				{"10.0.0.1:27017", replset.StatePrimary, 1},
+				{"10.0.0.2:27017", replset.StateSecondary, 1},
+				{"10.0.0.3:27017", replset.StateSecondary, 1},
+			},
+			setup: func(client *replset.Memory, d *testDiscovery) {
+				client.State.Members[0].OptimeDate = now
+				client.State.Members[1].OptimeDate = now.Add(-30 * time.Second)
+				client.State.Members[2].OptimeDate = now.Add(-2 * time.Minute)
+			},
+			code: CheckCritical,
+			messages: []string{
+				"10.0.0.2:27017 is 30s behind the primary",
+				"10.0.0.3:27017 is 2m0s behind the primary",
+			},
+		},
+		{
+			name: "unhealthy member",
+			members: []testMember{
+				{"10.0.0.1:27017", replset.StatePrimary, 1},
+				{"10.0.0.2:27017", replset.StateSecondary, 1},
+				{"10.0.0.3:27017", replset.StateDown, 1},
+			},
+			code:     CheckWarning,
+			messages: []string{"10.0.0.3:27017 is (not reachable/healthy)"},
+		},
+		{
+			name: "majority lost",
+			members: []testMember{
+				{"10.0.0.1:27017", replset.StateSecondary, 1},
+				{"10.0.0.2:27017", replset.StateDown, 1},
+				{"10.0.0.3:27017", replset.StateDown, 1},
+			},
+			code: CheckCritical,
+			messages: []string{
+				"majority lost, 3 voting members (0 arbiters), 1 healthy, 2 needed for a majority",
+				"no primary",
+				"10.0.0.2:27017 is (not reachable/healthy)",
+				"10.0.0.3:27017 is (not reachable/healthy)",
+			},
+		},
+		{
+			name: "short oplog",
+			members: []testMember{
+				{"10.0.0.1:27017", replset.StatePrimary, 1},
+				{"10.0.0.2:27017", replset.StateSecondary, 1},
+			},
+			setup: func(client *replset.Memory, d *testDiscovery) {
+				client.Oplog = &replset.OplogWindow{First: now.Add(-30 * time.Minute), Last: now}
+			},
+			code:     CheckCritical,
+			messages: []string{"oplog window is 30m0s"},
+		},
+		{
+			name: "drift",
+			members: []testMember{
+				{"10.0.0.1:27017", replset.StatePrimary, 1},
+				{"10.0.0.2:27017", replset.StateSecondary, 1},
+			},
+			setup: func(client *replset.Memory, d *testDiscovery) {
+				d.Deregister("mongodb", &discovery.Service{ID: "10.0.0.2:27017"})
+				d.Register("mongodb", &discovery.Service{ID: "10.0.0.9:27017", Addr: "10.0.0.9", Port: 27017})
+			},
+			code: CheckWarning,
+			messages: []string{
+				"10.0.0.2:27017 is not registered",
+				"10.0.0.9:27017 is registered but not a member",
+			},
+		},
+		{
+			name: "unreachable",
+			members: []testMember{
+				{"10.0.0.1:27017", replset.StatePrimary, 1},
+			},
+			setup: func(client *replset.Memory, d *testDiscovery) {
+				client.Err = errors.New("connection refused")
+			},
+			code:     CheckUnknown,
+			messages: []string{"connection refused"},
+		},
+	}
+
+	for _, tc := range cases {
+		client, d := testSet(tc.members...)
+		client.Oplog = &replset.OplogWindow{First: now.Add(-48 * time.Hour), Last: now}
+		if tc.setup != nil {
+			tc.setup(client, d)
+		}
+		meta, _ := testMeta(client, d)
+		c := &CheckCommand{Meta: meta}
+
+		if code := c.Run(nil); code != tc.code {
+			t.Errorf("%s: expected code %d, got %d", tc.name, tc.code, code)
+		}
+		result := c.check("", checkThresholds{
+			warnLag:   10 * time.Second,
+			critLag:   time.Minute,
+			warnOplog: 24 * time.Hour,
+			critOplog: time.Hour,
+		})
+		if !reflect.DeepEqual(result.Messages, tc.messages) {
+			t.Errorf("%s: expected messages %q, got %q", tc.name, tc.messages, result.Messages)
+		}
+	}
+}
+
+func TestCheckOutput_Table(t *testing.T) {
+	out := &checkOutput{Status: checkStatus[CheckOK]}
+	out.perf("healthy", 3, "", 0, 0)
+	out.perf("max_lag", 2, "s", 10*time.Second, time.Minute)
+	perf := out.perf("oplog_window", 86400, "s", 24*time.Hour, time.Hour)
+	perf.below = true
+	out.raise(CheckWarning, "10.0.0.3:27017 is RECOVERING")
+
+	expected := "MONGODB WARNING - 10.0.0.3:27017 is RECOVERING | " +
+		"healthy=3;;;0 max_lag=2s;10;60;0 oplog_window=86400s;86400:;3600:;0"
+	if actual := out.Table(); actual != expected {
+		t.Fatalf("expected %q, got %q", expected, actual)
+	}
+}
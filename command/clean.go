@@ -6,73 +6,175 @@ import (
 	"strings"
 	"time"
 
+	"github.com/aocsolutions/mongoctl/discovery"
+	"github.com/aocsolutions/mongoctl/replset"
 	"github.com/nevins-b/commgo"
-	"gopkg.in/mgo.v2"
-	"gopkg.in/mgo.v2/bson"
 )
 
 type CleanCommand struct {
 	Meta
+
+	// now returns the current time, time.Now if nil.
+	now func() time.Time
+}
+
+// cleanOptions are the settings of clean.
+type cleanOptions struct {
+	members       bool
+	registrations bool
+	force         bool
+	grace         time.Duration
+	stateFile     string
 }
 
 func (c *CleanCommand) Run(args []string) int {
 	var username string
-	flags := c.Meta.FlagSet("clean", FlagSetDefault)
+	var opts cleanOptions
+	flags := c.Meta.FlagSet("clean", FlagSetDefault|FlagSetDryRun)
 	flags.Usage = func() { c.Ui.Error(c.Help()) }
 	flags.StringVar(&username, "username", "", "")
+	flags.BoolVar(&opts.members, "members", true, "")
+	flags.BoolVar(&opts.registrations, "registrations", true, "")
+	flags.BoolVar(&opts.force, "force", false, "")
+	flags.DurationVar(&opts.grace, "grace", 5*time.Minute, "")
+	flags.StringVar(&opts.stateFile, "state-file", "", "")
 
 	if err := flags.Parse(args); err != nil {
 		return 1
 	}
-
-	node, err := c.Meta.GetNode()
-	if err != nil {
-		c.Ui.Error(err.Error())
+	if !opts.members && !opts.registrations {
+		c.Ui.Error("Error: nothing to clean, -members and -registrations are both false")
 		return 1
 	}
 
-	info := &mgo.DialInfo{
-		Addrs:    []string{node},
-		Timeout:  5 * time.Second,
-		Username: username,
+	client, err := c.Meta.Client(username, false)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
 	}
+	defer client.Close()
 
-	if len(username) > 0 {
-		info.Password, _ = c.Ui.Ask("Password: ")
-	}
-	session, err := mgo.DialWithInfo(info)
+	d, err := c.Meta.Discovery()
 	if err != nil {
-		c.Ui.Error(err.Error())
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
 		return 1
 	}
-	defer session.Close()
+	if d == nil && opts.registrations {
+		if !opts.members {
+			c.Ui.Error("Error: cleaning registrations requires a discovery backend")
+			return 1
+		}
+		c.Ui.Info("No discovery backend, only cleaning members")
+		opts.registrations = false
+	}
 
-	registered, err := c.Meta.consulAgent.GetService(c.Meta.consulKey, "")
+	status, err := client.Status()
 	if err != nil {
-		c.Ui.Error(err.Error())
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
 		return 1
 	}
-	status := &commgo.RsStatus{}
-	cmd := &bson.M{
-		"replSetGetStatus": "",
+
+	out := &cleanOutput{
+		changeOutput: *newChangeOutput(nil, c.Meta.dryRun),
+		Pending:      []pendingRemoval{},
 	}
+	out.Set = status.Set
 
-	if err := session.DB("admin").Run(&cmd, &status); err != nil {
+	// Only clean up members which have been down for the grace period,
+	// so that a brief outage doesn't eject a healthy member or its
+	// registration.
+	store, err := c.Meta.stateStore(d, opts.stateFile)
+	if err != nil {
 		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
 		return 1
 	}
+	history, err := loadDownHistory(store, c.Meta.serviceName)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+	dead := c.expired(history, status, opts.grace, out)
+
+	// Remove members before their registrations, so that a removal the
+	// quorum check refuses leaves the member registered.
+	code := 0
+	if opts.members {
+		code = c.cleanMembers(client, status, dead, &opts, out)
+		for _, host := range out.Removed {
+			delete(history, host)
+		}
+	}
+	if code == 0 && opts.registrations {
+		if err := c.cleanRegistrations(d, status, dead, out); err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+			code = 1
+		}
+	}
 
+	// Save the history even if cleaning failed, so that the grace
+	// period of members first seen down now doesn't start over.
+	if !c.Meta.dryRun {
+		if err := history.save(store, c.Meta.serviceName); err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+			return 1
+		}
+	}
+	if code != 0 {
+		return code
+	}
+	return c.Meta.output(out)
+}
+
+// expired updates history with the members which are DOWN and returns
+// those which have been down for grace, reporting the others as
+// pending.
+func (c *CleanCommand) expired(history downHistory, status *commgo.RsStatus, grace time.Duration, out *cleanOutput) []string {
+	var down []string
+	for _, member := range status.Members {
+		if member.State == replset.StateDown {
+			down = append(down, member.Name)
+		}
+	}
+
+	now := time.Now()
+	if c.now != nil {
+		now = c.now()
+	}
+	expired, pending := history.expire(down, grace, now)
+	for _, host := range pending {
+		since := history[host]
+		c.Ui.Info(fmt.Sprintf("Host %s is down since %s, removing after %s",
+			host, since.Format(time.RFC3339), since.Add(grace).Format(time.RFC3339)))
+		out.Pending = append(out.Pending, pendingRemoval{
+			Host:      host,
+			DownSince: since,
+			RemoveAt:  since.Add(grace),
+		})
+	}
+	return expired
+}
+
+// cleanRegistrations deregisters services which aren't members of the
+// set, or which are members in dead. Members which are down but still
+// within the grace period keep their registration.
+func (c *CleanCommand) cleanRegistrations(d discovery.Discovery, status *commgo.RsStatus, dead []string, out *cleanOutput) error {
+	registered, err := d.Lookup(c.Meta.serviceName)
+	if err != nil {
+		return err
+	}
+
+	expired := make(map[string]bool)
+	for _, host := range dead {
+		expired[host] = true
+	}
 	var live []*commgo.RsMemberStats
-	var dead []*commgo.RsMemberStats
 	for _, member := range status.Members {
-		if member.State == 8 {
-			dead = append(dead, member)
-		} else {
+		if !expired[member.Name] {
 			live = append(live, member)
 		}
 	}
 
-	// Clean up nodes which are not live but are in consul
+	// Clean up nodes which are not live but are registered
 	for _, node := range registered {
 		found := false
 		for _, member := range live {
@@ -83,86 +185,98 @@ func (c *CleanCommand) Run(args []string) int {
 			}
 			host := parts[0]
 			port, _ := strconv.Atoi(parts[1])
-			if node.Address == host && node.ServicePort == port {
+			if node.Addr == host && node.Port == port {
 				found = true
 				break
 			}
 		}
 		if !found {
-			c.Ui.Info(fmt.Sprintf("Node %s not found, removing from Consul", node.ServiceID))
-			err := c.Meta.consulAgent.RemoveService(node)
+			c.Ui.Info(fmt.Sprintf("Node %s not found, removing from discovery", node.ID))
+			ok, err := c.Meta.deregister(d, node)
 			if err != nil {
 				c.Ui.Error(err.Error())
+				continue
+			}
+			if ok {
+				out.Deregistered = append(out.Deregistered, node.ID)
 			}
 		}
 	}
+	return nil
+}
 
+// cleanMembers removes the dead members from the set.
+func (c *CleanCommand) cleanMembers(client replset.Client, status *commgo.RsStatus, dead []string, opts *cleanOptions, out *cleanOutput) int {
 	// Remove dead nodes from the Replica
 	if len(dead) > 0 {
-		config := &commgo.RsConf{}
-
-		conn := session.DB("local").C("system.replset")
-		count, err := conn.Count()
-		if count > 1 {
-			c.Ui.Error("Error: local.system.replset has unexpected contents")
-			return 1
-		}
-		err = conn.Find(bson.M{}).One(&config)
+		config, err := client.GetConfig()
 		if err != nil {
 			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
 			return 1
 		}
 
-		config.Version++
-
-		for _, member := range dead {
-			c.Ui.Info(fmt.Sprintf("Removing dead host %s", member.Name))
-			for i, host := range config.Members {
-				if host.Host == member.Name {
-					config.Members = append(config.Members[:i], config.Members[i+1:]...)
-					break
-				}
-			}
+		if !c.Meta.checkRemove(config, status, opts.force, dead...) {
+			return 1
 		}
 
-		cmd := &bson.M{
-			"replSetReconfig": config,
+		for _, host := range dead {
+			c.Ui.Info(fmt.Sprintf("Removing dead host %s", host))
+			replset.RemoveMember(config, host)
 		}
-		result := bson.M{}
-		if err := session.DB("admin").Run(&cmd, &result); err != nil {
+
+		if err := client.Reconfig(config); err != nil {
 			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
 			return 1
 		}
-
+		out.Version = config.Version
+		out.Removed = append(out.Removed, dead...)
 	}
-
 	return 0
 }
 
 func (c *CleanCommand) Help() string {
 	helpText := `
 Usage: mongoctl clean [options]
-  Get the status of a Mongo Cluster
-  This command connects to a Mongo server and retrieves the status
-	of the cluster.
+  Remove dead members from a Mongo Replica Set and discovery.
+  This command connects to a Mongo server, removes members which have
+  been DOWN for the grace period from the set, and deregisters services
+  which aren't members or have been DOWN for the grace period from the
+  discovery backend. Without a discovery backend only the members are
+  cleaned.
 
 General Options:
-  -mongo=addr             The address of the Mongo server if not using Consul.
+  ` + generalOptionsUsage() + `
+
+Clean Options:
 
-  -consul-service=service The service name to use when looking up Mongo
-	                        with consul.
+  -username=username      The username to authenticate with if required.
 
-	-consul-server=addr			The address of the consul server to use,
-	                        this defaults to 127.0.0.1:8500.
-  -consul                 Use consul to find Mongo
+  -members=false          Don't remove dead members from the set.
+                          Defaults to true.
 
-Clean Options:
+  -registrations=false    Don't deregister services which aren't members
+                          or have been down for the grace period.
+                          Defaults to true, and is skipped when there is
+                          no discovery backend.
+
+  -force                  Remove dead members even if the set would be
+                          left without a voting majority.
+
+  -grace=duration         How long a member must have been down before it
+                          and its registration are removed. Until then it
+                          is reported as pending.
+                          Defaults to 5m, 0 removes dead members at once.
+
+  -state-file=path        The file to record when members were first seen
+                          down in. Defaults to the discovery backend if it
+                          can store state, such as consul KV, otherwise
+                          the state_file config or ~/.mongoctl-state.
 
-	-username=username      The username to authenticate with if required.
+  ` + dryRunOptionsUsage() + `
 `
 	return strings.TrimSpace(helpText)
 }
 
 func (c *CleanCommand) Synopsis() string {
-	return "Remove dead nodes from Consul"
+	return "Remove dead members from the set and discovery"
 }
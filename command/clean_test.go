@@ -0,0 +1,175 @@
+package command
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aocsolutions/mongoctl/discovery"
+	"github.com/aocsolutions/mongoctl/replset"
+)
+
+func TestCleanCommand(t *testing.T) {
+	client, d := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+		testMember{"10.0.0.3:27017", replset.StateSecondary, 1},
+		testMember{"10.0.0.4:27017", replset.StateDown, 1},
+	)
+	d.Register("mongodb", &discovery.Service{ID: "10.0.0.9:27017", Addr: "10.0.0.9", Port: 27017})
+
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	run := func() {
+		meta, ui := testMeta(client, d)
+		c := &CleanCommand{Meta: meta, now: func() time.Time { return now }}
+		if code := c.Run([]string{"-grace", "5m"}); code != 0 {
+			t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+		}
+	}
+
+	// The stale registration goes at once, the down member is pending
+	// and keeps its registration.
+	run()
+	if len(client.Reconfigs) != 0 {
+		t.Fatalf("expected no reconfig within the grace period, got %d", len(client.Reconfigs))
+	}
+	expected := []string{"10.0.0.1:27017", "10.0.0.2:27017", "10.0.0.3:27017", "10.0.0.4:27017"}
+	if actual := d.ids("mongodb"); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected registrations %v, got %v", expected, actual)
+	}
+
+	now = now.Add(4 * time.Minute)
+	run()
+	if len(client.Reconfigs) != 0 {
+		t.Fatalf("expected no reconfig within the grace period, got %d", len(client.Reconfigs))
+	}
+
+	now = now.Add(time.Minute)
+	run()
+	expected = []string{"10.0.0.1:27017", "10.0.0.2:27017", "10.0.0.3:27017"}
+	if actual := hosts(client.Config); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected members %v, got %v", expected, actual)
+	}
+	if actual := d.ids("mongodb"); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected registrations %v, got %v", expected, actual)
+	}
+
+	store, _ := new(Meta).stateStore(d, "")
+	history, err := loadDownHistory(store, "mongodb")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(history) != 0 {
+		t.Fatalf("expected the removed member to be forgotten, got %v", history)
+	}
+}
+
+func TestCleanCommand_recovered(t *testing.T) {
+	client, d := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+		testMember{"10.0.0.3:27017", replset.StateDown, 1},
+	)
+
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	run := func() {
+		meta, ui := testMeta(client, d)
+		c := &CleanCommand{Meta: meta, now: func() time.Time { return now }}
+		if code := c.Run([]string{"-grace", "5m"}); code != 0 {
+			t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+		}
+	}
+
+	run()
+
+	// A member which comes back restarts its grace period the next time
+	// it goes down.
+	client.State.Members[2].State = replset.StateSecondary
+	now = now.Add(3 * time.Minute)
+	run()
+	client.State.Members[2].State = replset.StateDown
+	now = now.Add(3 * time.Minute)
+	run()
+
+	if len(client.Reconfigs) != 0 {
+		t.Fatalf("expected no reconfig, got %d", len(client.Reconfigs))
+	}
+}
+
+func TestCleanCommand_noGrace(t *testing.T) {
+	client, d := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateDown, 1},
+		testMember{"10.0.0.3:27017", replset.StateDown, 1},
+	)
+	meta, ui := testMeta(client, d)
+	c := &CleanCommand{Meta: meta}
+
+	if code := c.Run([]string{"-grace", "0"}); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+	if len(client.Reconfigs) != 1 {
+		t.Fatalf("expected one reconfig, got %d", len(client.Reconfigs))
+	}
+	expected := []string{"10.0.0.1:27017"}
+	if actual := hosts(client.Config); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected members %v, got %v", expected, actual)
+	}
+	if actual := d.ids("mongodb"); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected registrations %v, got %v", expected, actual)
+	}
+}
+
+func TestCleanCommand_dryRun(t *testing.T) {
+	client, d := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+		testMember{"10.0.0.3:27017", replset.StateSecondary, 1},
+		testMember{"10.0.0.4:27017", replset.StateDown, 1},
+	)
+	meta, ui := testMeta(client, d)
+	c := &CleanCommand{Meta: meta}
+
+	if code := c.Run([]string{"-grace", "0", "-dry-run"}); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+	if len(client.Reconfigs) != 0 {
+		t.Fatalf("expected no reconfig, got %d", len(client.Reconfigs))
+	}
+	if ids := d.ids("mongodb"); len(ids) != 4 {
+		t.Fatalf("expected no deregistration, got %v", ids)
+	}
+	if len(d.State) != 0 {
+		t.Fatalf("expected no state to be saved, got %v", d.State)
+	}
+}
+
+func TestCleanCommand_removeFails(t *testing.T) {
+	client, d := testSet(
+		testMember{"10.0.0.1:27017", replset.StateSecondary, 1},
+		testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+		testMember{"10.0.0.3:27017", replset.StateDown, 1},
+	)
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	meta, _ := testMeta(client, d)
+	c := &CleanCommand{Meta: meta, now: func() time.Time { return now }}
+
+	// Without a primary the reconfig is refused, so the dead member
+	// stays in the set and keeps its registration.
+	if code := c.Run([]string{"-grace", "0"}); code != 1 {
+		t.Fatalf("expected failure, got %d", code)
+	}
+	if ids := d.ids("mongodb"); len(ids) != 3 {
+		t.Fatalf("expected no deregistration, got %v", ids)
+	}
+
+	// When it was first seen down is still recorded.
+	store, _ := new(Meta).stateStore(d, "")
+	history, err := loadDownHistory(store, "mongodb")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if since, ok := history["10.0.0.3:27017"]; !ok || !since.Equal(now) {
+		t.Fatalf("expected 10.0.0.3:27017 down since %s, got %v", now, history)
+	}
+}
@@ -0,0 +1,163 @@
+package command
+
+import (
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/aocsolutions/mongoctl/discovery"
+	"github.com/aocsolutions/mongoctl/replset"
+	"github.com/mitchellh/cli"
+	"github.com/nevins-b/commgo"
+)
+
+// testDiscovery is an in-memory discovery backend, which also stores
+// state so that tests don't touch the state file. Like Consul and etcd,
+// registering a service again replaces it.
+type testDiscovery struct {
+	Services map[string][]*discovery.Service
+	State    map[string][]byte
+
+	// ReadOnly makes Register and Deregister return ErrReadOnly, as
+	// the dns and inventory backends do.
+	ReadOnly bool
+
+	lock sync.Mutex
+}
+
+func (d *testDiscovery) Lookup(name string) ([]*discovery.Service, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return append([]*discovery.Service(nil), d.Services[name]...), nil
+}
+
+func (d *testDiscovery) Register(name string, service *discovery.Service) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.ReadOnly {
+		return discovery.ErrReadOnly
+	}
+	if d.Services == nil {
+		d.Services = make(map[string][]*discovery.Service)
+	}
+	for i, s := range d.Services[name] {
+		if s.ID == service.ID {
+			d.Services[name][i] = service
+			return nil
+		}
+	}
+	d.Services[name] = append(d.Services[name], service)
+	return nil
+}
+
+func (d *testDiscovery) Deregister(name string, service *discovery.Service) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.ReadOnly {
+		return discovery.ErrReadOnly
+	}
+	var services []*discovery.Service
+	for _, s := range d.Services[name] {
+		if s.ID != service.ID {
+			services = append(services, s)
+		}
+	}
+	d.Services[name] = services
+	return nil
+}
+
+func (d *testDiscovery) Get(name, key string) ([]byte, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.State[name+"/"+key], nil
+}
+
+func (d *testDiscovery) Put(name, key string, value []byte) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.State == nil {
+		d.State = make(map[string][]byte)
+	}
+	d.State[name+"/"+key] = value
+	return nil
+}
+
+// ids returns the IDs of the services registered under name.
+func (d *testDiscovery) ids(name string) []string {
+	var ids []string
+	for _, service := range d.Services[name] {
+		ids = append(ids, service.ID)
+	}
+	return ids
+}
+
+// testMember describes a member of a test replica set.
+type testMember struct {
+	host     string
+	state    int
+	priority float64
+}
+
+// testSet returns a client for a replica set with the given members,
+// along with a discovery backend with each of them registered as
+// mongodb.
+func testSet(members ...testMember) (*replset.Memory, *testDiscovery) {
+	client := &replset.Memory{
+		Config: &commgo.RsConf{ID: "rs0", Version: 1},
+		State:  &commgo.RsStatus{Set: "rs0"},
+	}
+	d := &testDiscovery{}
+	for i, member := range members {
+		client.Config.Members = append(client.Config.Members, &commgo.Host{
+			ID:           int64(i),
+			Host:         member.host,
+			BuildIndexes: true,
+			Votes:        1,
+			Priority:     member.priority,
+		})
+		client.State.Members = append(client.State.Members, &commgo.RsMemberStats{
+			Name:     member.host,
+			State:    member.state,
+			StateStr: stateStr(member.state),
+		})
+
+		addr, rawPort, _ := net.SplitHostPort(member.host)
+		port, _ := strconv.Atoi(rawPort)
+		d.Register("mongodb", &discovery.Service{ID: member.host, Addr: addr, Port: port})
+	}
+	return client, d
+}
+
+func stateStr(state int) string {
+	switch state {
+	case replset.StatePrimary:
+		return "PRIMARY"
+	case replset.StateSecondary:
+		return "SECONDARY"
+	case replset.StateArbiter:
+		return "ARBITER"
+	case replset.StateDown:
+		return "(not reachable/healthy)"
+	}
+	return "UNKNOWN"
+}
+
+// testMeta returns the Meta for a command using client and d.
+func testMeta(client replset.Client, d discovery.Discovery) (Meta, *cli.MockUi) {
+	ui := new(cli.MockUi)
+	return Meta{
+		Ui:             ui,
+		ForceConfig:    &Config{},
+		ForceClient:    client,
+		ForceDiscovery: d,
+	}, ui
+}
+
+// hosts returns the hosts of the members of config.
+func hosts(config *commgo.RsConf) []string {
+	var hosts []string
+	for _, member := range config.Members {
+		hosts = append(hosts, member.Host)
+	}
+	return hosts
+}
@@ -26,6 +26,47 @@ type Config struct {
 	// is not specified, then vault token-disk will be used, which stores
 	// the token on disk unencrypted.
 	TokenHelper string `hcl:"token_helper"`
+
+	// Discovery is the name of the discovery backend used to find
+	// Mongo when none is given on the command line.
+	Discovery string `hcl:"discovery"`
+
+	// DNSDomain and DNSServer configure the dns discovery backend.
+	DNSDomain string `hcl:"dns_domain"`
+	DNSServer string `hcl:"dns_server"`
+
+	// EtcdEndpoints is a comma separated list of etcd endpoints, and
+	// EtcdPrefix and EtcdTTL control how registrations are stored.
+	EtcdEndpoints string `hcl:"etcd_endpoints"`
+	EtcdPrefix    string `hcl:"etcd_prefix"`
+	EtcdTTL       int64  `hcl:"etcd_ttl"`
+
+	// Inventory is the path of the inventory file used by the
+	// inventory discovery backend.
+	Inventory string `hcl:"inventory"`
+
+	// StateFile is where clean records when members were first seen
+	// down if the discovery backend can't store it.
+	StateFile string `hcl:"state_file"`
+
+	// The Consul settings below are used by the consul discovery
+	// backend when not given on the command line.
+	ConsulServer     string `hcl:"consul_server"`
+	ConsulScheme     string `hcl:"consul_scheme"`
+	ConsulDatacenter string `hcl:"consul_datacenter"`
+	ConsulToken      string `hcl:"consul_token"`
+	ConsulCAFile     string `hcl:"consul_ca_file"`
+	ConsulCertFile   string `hcl:"consul_cert_file"`
+	ConsulKeyFile    string `hcl:"consul_key_file"`
+
+	// The Consul check settings configure the health check registered
+	// with each member.
+	ConsulCheck                   string `hcl:"consul_check"`
+	ConsulCheckInterval           string `hcl:"consul_check_interval"`
+	ConsulCheckTimeout            string `hcl:"consul_check_timeout"`
+	ConsulCheckTTL                string `hcl:"consul_check_ttl"`
+	ConsulCheckHTTP               string `hcl:"consul_check_http"`
+	ConsulCheckDeregisterCritical string `hcl:"consul_check_deregister_critical_after"`
 }
 
 // LoadConfig reads the configuration from the given path. If path is
@@ -0,0 +1,77 @@
+package command
+
+import (
+	"github.com/aocsolutions/mongoctl/discovery"
+	"github.com/aocsolutions/mongoctl/replset"
+	"github.com/nevins-b/commgo"
+)
+
+// registrationDrift compares the members of config with the services
+// registered in discovery. It returns the members which aren't
+// registered and the registrations which aren't members.
+func registrationDrift(config *commgo.RsConf, services []*discovery.Service) ([]string, []*discovery.Service) {
+	registered := make(map[string]bool)
+	var stale []*discovery.Service
+	for _, service := range services {
+		registered[service.String()] = true
+		if replset.FindMember(config, service.String()) < 0 {
+			stale = append(stale, service)
+		}
+	}
+
+	var unregistered []string
+	for _, member := range config.Members {
+		if !registered[member.Host] {
+			unregistered = append(unregistered, member.Host)
+		}
+	}
+	return unregistered, stale
+}
+
+// setDrift is the three-way drift between the registrations in
+// discovery, the members of the set configuration and their health in
+// replSetGetStatus.
+type setDrift struct {
+	// Unregistered are healthy members which aren't registered.
+	Unregistered []string
+
+	// Stale are registrations which aren't members of the set.
+	Stale []*discovery.Service
+
+	// Dead are members which the set reports as DOWN, whether or not
+	// they are registered.
+	Dead []string
+
+	// Unhealthy are members which are neither healthy nor DOWN, such as
+	// those recovering or in initial sync. They are only reported.
+	Unhealthy []string
+}
+
+// newSetDrift computes the drift of services against the set.
+func newSetDrift(config *commgo.RsConf, status *commgo.RsStatus, services []*discovery.Service) *setDrift {
+	unregistered, stale := registrationDrift(config, services)
+	drift := &setDrift{Stale: stale}
+
+	for _, host := range unregistered {
+		if stats := replset.FindStats(status, host); stats != nil && replset.Healthy(stats) {
+			drift.Unregistered = append(drift.Unregistered, host)
+		}
+	}
+	for _, member := range config.Members {
+		stats := replset.FindStats(status, member.Host)
+		switch {
+		case stats == nil:
+		case stats.State == replset.StateDown:
+			drift.Dead = append(drift.Dead, member.Host)
+		case !replset.Healthy(stats):
+			drift.Unhealthy = append(drift.Unhealthy, member.Host)
+		}
+	}
+	return drift
+}
+
+// Empty returns whether discovery and the set agree and every member is
+// healthy.
+func (d *setDrift) Empty() bool {
+	return len(d.Unregistered) == 0 && len(d.Stale) == 0 && len(d.Dead) == 0 && len(d.Unhealthy) == 0
+}
@@ -0,0 +1,209 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aocsolutions/mongoctl/replset"
+	"github.com/nevins-b/commgo"
+)
+
+type ElectCommand struct {
+	Meta
+}
+
+func (c *ElectCommand) Run(args []string) int {
+	var username string
+	var keepPriority bool
+	var catchUp, timeout time.Duration
+	flags := c.Meta.FlagSet("elect", FlagSetDefault)
+	flags.Usage = func() { c.Ui.Error(c.Help()) }
+	flags.StringVar(&username, "username", "", "")
+	flags.BoolVar(&keepPriority, "keep-priority", false, "")
+	flags.DurationVar(&catchUp, "catch-up", 10*time.Second, "")
+	flags.DurationVar(&timeout, "timeout", 2*time.Minute, "")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if len(flags.Args()) != 1 {
+		c.Ui.Error("Error: the member to elect must be given")
+		c.Ui.Error(c.Help())
+		return 1
+	}
+	target := flags.Args()[0]
+
+	client, err := c.Meta.Client(username, false)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+	defer client.Close()
+
+	config, err := client.GetConfig()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+	i := replset.FindMember(config, target)
+	if i < 0 {
+		c.Ui.Error(fmt.Sprintf("Node %s not found in cluster", target))
+		return 1
+	}
+	member := config.Members[i]
+	if member.ArbiterOnly || member.Hidden || member.SlaveDelay > 0 || member.Votes == 0 {
+		c.Ui.Error(fmt.Sprintf("Error: %s can not be elected primary", target))
+		return 1
+	}
+
+	status, err := client.Status()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+	primary := replset.Primary(status)
+	if primary == nil {
+		c.Ui.Error("Error: the replica set has no primary")
+		return 1
+	}
+	if primary.Name == target {
+		return c.Meta.output(&primaryOutput{
+			Previous: target,
+			Primary:  target,
+		})
+	}
+	var others []string
+	for _, stats := range status.Members {
+		if stats.Name == target && stats.State != replset.StateSecondary {
+			c.Ui.Error(fmt.Sprintf("Error: %s is %s, not SECONDARY", target, stats.StateStr))
+			return 1
+		}
+		if stats.Name != target && stats.State == replset.StateSecondary {
+			others = append(others, stats.Name)
+		}
+	}
+
+	// Restoring the priority after the election would let a member
+	// with a higher priority take over again, so only go ahead if the
+	// raised priority is kept.
+	original := member.Priority
+	var highest float64
+	for _, m := range config.Members {
+		if m.Priority > highest {
+			highest = m.Priority
+		}
+		if m.Priority > original && !keepPriority {
+			c.Ui.Error(fmt.Sprintf("Error: %s has priority %v, above %v of %s, and would take over "+
+				"as primary once the priority is restored, use -keep-priority", m.Host, m.Priority, original, target))
+			return 1
+		}
+	}
+
+	// Give the target the highest priority so it is preferred, and
+	// keep the other secondaries from winning the election.
+	if member.Priority <= highest {
+		member.Priority = highest + 1
+		c.Ui.Info(fmt.Sprintf("Raising priority of %s to %v", target, member.Priority))
+		if err := client.Reconfig(config); err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+			return 1
+		}
+	}
+
+	freeze := int((timeout + catchUp) / time.Second)
+	for _, host := range others {
+		c.Ui.Info(fmt.Sprintf("Freezing %s", host))
+		if err := c.freeze(host, username, freeze); err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s: %s", host, err.Error()))
+		}
+	}
+
+	c.Ui.Info(fmt.Sprintf("Stepping down primary %s", primary.Name))
+	code := 0
+	if err := client.StepDown(freeze, int(catchUp/time.Second)); err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		code = 1
+	} else {
+		_, err := replset.WaitForPrimaryOf(client, func(m *commgo.RsMemberStats) bool {
+			return m.Name == target
+		}, timeout)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+			code = 1
+		} else {
+			code = c.Meta.output(&primaryOutput{
+				Previous: primary.Name,
+				Primary:  target,
+			})
+		}
+	}
+
+	for _, host := range others {
+		if err := c.freeze(host, username, 0); err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s: %s", host, err.Error()))
+		}
+	}
+
+	if keepPriority || member.Priority == original {
+		return code
+	}
+
+	// Put the priority back now that the election is over
+	config, err = client.GetConfig()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+	if i = replset.FindMember(config, target); i >= 0 {
+		config.Members[i].Priority = original
+		c.Ui.Info(fmt.Sprintf("Restoring priority of %s to %v", target, original))
+		if err := client.Reconfig(config); err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+			return 1
+		}
+	}
+	return code
+}
+
+func (c *ElectCommand) freeze(host, username string, seconds int) error {
+	client, err := c.Meta.dial(host, username, true)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return client.Freeze(seconds)
+}
+
+func (c *ElectCommand) Help() string {
+	helpText := `
+Usage: mongoctl elect [options] host:port
+  Move the primary of a Mongo Replica Set to the given member.
+  This command temporarily raises the priority of the member, freezes the
+  other secondaries, steps down the current primary and waits until the
+  member is primary. The priority is restored afterwards, so a member
+  with a lower priority than another can only be elected with
+  -keep-priority.
+
+General Options:
+  ` + generalOptionsUsage() + `
+
+Elect Options:
+
+  -username=username      The username to authenticate with if required.
+
+  -keep-priority          Keep the raised priority so the member stays
+                          primary.
+
+  -catch-up=duration      How long to wait for the member to catch up
+                          before the primary steps down. Defaults to 10s.
+
+  -timeout=duration       How long to wait for the member to become
+                          primary. Defaults to 2m.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *ElectCommand) Synopsis() string {
+	return "Move the primary to a chosen member"
+}
@@ -0,0 +1,117 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/aocsolutions/mongoctl/replset"
+)
+
+func TestElectCommand(t *testing.T) {
+	client, d := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+		testMember{"10.0.0.3:27017", replset.StateSecondary, 1},
+	)
+	meta, ui := testMeta(client, d)
+	c := &ElectCommand{Meta: meta}
+
+	if code := c.Run([]string{"10.0.0.3:27017"}); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+
+	status, _ := client.Status()
+	if primary := replset.Primary(status); primary == nil || primary.Name != "10.0.0.3:27017" {
+		t.Fatalf("expected 10.0.0.3:27017 to be primary, got %#v", primary)
+	}
+	if len(client.Reconfigs) != 2 {
+		t.Fatalf("expected the priority to be raised and restored, got %d reconfigs", len(client.Reconfigs))
+	}
+	if raised := client.Reconfigs[0].Members[2].Priority; raised != 2 {
+		t.Fatalf("expected the priority to be raised to 2, got %v", raised)
+	}
+	if restored := client.Config.Members[2].Priority; restored != 1 {
+		t.Fatalf("expected the priority to be restored to 1, got %v", restored)
+	}
+}
+
+func TestElectCommand_keepPriority(t *testing.T) {
+	client, d := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 2},
+		testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+	)
+	meta, ui := testMeta(client, d)
+	c := &ElectCommand{Meta: meta}
+
+	if code := c.Run([]string{"10.0.0.2:27017"}); code != 1 {
+		t.Fatalf("expected the election to be refused, got %d", code)
+	}
+	if len(client.Reconfigs) != 0 {
+		t.Fatalf("expected no reconfig, got %d", len(client.Reconfigs))
+	}
+
+	meta, ui = testMeta(client, d)
+	c = &ElectCommand{Meta: meta}
+	if code := c.Run([]string{"-keep-priority", "10.0.0.2:27017"}); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+	if len(client.Reconfigs) != 1 {
+		t.Fatalf("expected the priority to be kept, got %d reconfigs", len(client.Reconfigs))
+	}
+	if kept := client.Config.Members[1].Priority; kept != 3 {
+		t.Fatalf("expected priority 3, got %v", kept)
+	}
+}
+
+func TestElectCommand_unelectable(t *testing.T) {
+	cases := []struct {
+		name   string
+		target string
+		setup  func(*replset.Memory)
+	}{
+		{
+			name:   "unknown member",
+			target: "10.0.0.9:27017",
+		},
+		{
+			name:   "hidden",
+			target: "10.0.0.2:27017",
+			setup: func(client *replset.Memory) {
+				client.Config.Members[1].Hidden = true
+				client.Config.Members[1].Priority = 0
+			},
+		},
+		{
+			name:   "down",
+			target: "10.0.0.2:27017",
+			setup: func(client *replset.Memory) {
+				client.State.Members[1].State = replset.StateDown
+			},
+		},
+		{
+			name:   "no primary",
+			target: "10.0.0.2:27017",
+			setup: func(client *replset.Memory) {
+				client.State.Members[0].State = replset.StateSecondary
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		client, d := testSet(
+			testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+			testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+		)
+		if tc.setup != nil {
+			tc.setup(client)
+		}
+		meta, _ := testMeta(client, d)
+		c := &ElectCommand{Meta: meta}
+
+		if code := c.Run([]string{tc.target}); code != 1 {
+			t.Errorf("%s: expected failure, got %d", tc.name, code)
+		}
+		if len(client.Reconfigs) != 0 {
+			t.Errorf("%s: expected no reconfig", tc.name)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package command
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/aocsolutions/mongoctl/replset"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+type ExporterCommand struct {
+	Meta
+}
+
+func (c *ExporterCommand) Run(args []string) int {
+	var username, listen, path string
+	flags := c.Meta.FlagSet("exporter", FlagSetDefault)
+	flags.Usage = func() { c.Ui.Error(c.Help()) }
+	flags.StringVar(&username, "username", "", "")
+	flags.StringVar(&listen, "listen", ":9216", "")
+	flags.StringVar(&path, "path", "/metrics", "")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	if !strings.HasPrefix(path, "/") {
+		c.Ui.Error(fmt.Sprintf("Error: -path must start with /, got %q", path))
+		return 1
+	}
+
+	client, err := c.Meta.Client(username, false)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+	defer client.Close()
+
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(newExporter(&c.Meta, client)); err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+
+	mux := newExporterMux(registry, path)
+
+	c.Ui.Info(fmt.Sprintf("Serving metrics on %s%s", listen, path))
+	if err := http.ListenAndServe(listen, mux); err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+	return 0
+}
+
+// newExporterMux serves the metrics in registry on path, and a landing
+// page linking to them on / unless the metrics are served there.
+func newExporterMux(registry *prometheus.Registry, path string) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle(path, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	if path != "/" {
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "<html><body><h1>mongoctl exporter</h1><a href=%q>Metrics</a></body></html>", path)
+		})
+	}
+	return mux
+}
+
+var (
+	exporterUp = prometheus.NewDesc("mongoctl_up",
+		"Whether the status of the replica set could be read.", nil, nil)
+	exporterMemberState = prometheus.NewDesc("mongoctl_member_state",
+		"The state of the member as reported by replSetGetStatus.", []string{"set", "member"}, nil)
+	exporterMemberHealth = prometheus.NewDesc("mongoctl_member_health",
+		"The health of the member as reported by replSetGetStatus.", []string{"set", "member"}, nil)
+	exporterMemberUsable = prometheus.NewDesc("mongoctl_member_usable",
+		"Whether the member is PRIMARY, SECONDARY or ARBITER.", []string{"set", "member"}, nil)
+	exporterMemberLag = prometheus.NewDesc("mongoctl_member_replication_lag_seconds",
+		"How far the member is behind the primary.", []string{"set", "member"}, nil)
+	exporterMemberPing = prometheus.NewDesc("mongoctl_member_ping_seconds",
+		"The heartbeat round trip time to the member.", []string{"set", "member"}, nil)
+	exporterOplogWindow = prometheus.NewDesc("mongoctl_oplog_window_seconds",
+		"The time between the first and last entries in the oplog of the primary.", []string{"set"}, nil)
+	exporterElections = prometheus.NewDesc("mongoctl_elections_observed_total",
+		"The number of times the exporter has seen the primary change.", []string{"set"}, nil)
+	exporterConfigVersion = prometheus.NewDesc("mongoctl_config_version",
+		"The version of the replica set configuration.", []string{"set"}, nil)
+	exporterConfigMembers = prometheus.NewDesc("mongoctl_config_members",
+		"The number of members in the replica set configuration.", []string{"set"}, nil)
+	exporterVoters = prometheus.NewDesc("mongoctl_voting_members",
+		"The number of voting members in the replica set configuration.", []string{"set"}, nil)
+	exporterHealthyVoters = prometheus.NewDesc("mongoctl_healthy_voting_members",
+		"The number of voting members which are healthy.", []string{"set"}, nil)
+	exporterUnregistered = prometheus.NewDesc("mongoctl_discovery_unregistered_members",
+		"The number of members which aren't registered in discovery.", []string{"set"}, nil)
+	exporterStale = prometheus.NewDesc("mongoctl_discovery_stale_registrations",
+		"The number of registrations in discovery which aren't members.", []string{"set"}, nil)
+)
+
+// exporter is a prometheus.Collector which reads the state of the set
+// on every scrape.
+type exporter struct {
+	meta   *Meta
+	client replset.Client
+
+	// lock serializes scrapes, which also guards the fields below.
+	lock      sync.Mutex
+	primary   string
+	elections float64
+}
+
+func newExporter(meta *Meta, client replset.Client) *exporter {
+	return &exporter{
+		meta:   meta,
+		client: client,
+	}
+}
+
+func (e *exporter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- exporterUp
+	ch <- exporterMemberState
+	ch <- exporterMemberHealth
+	ch <- exporterMemberUsable
+	ch <- exporterMemberLag
+	ch <- exporterMemberPing
+	ch <- exporterOplogWindow
+	ch <- exporterElections
+	ch <- exporterConfigVersion
+	ch <- exporterConfigMembers
+	ch <- exporterVoters
+	ch <- exporterHealthyVoters
+	ch <- exporterUnregistered
+	ch <- exporterStale
+}
+
+func (e *exporter) Collect(ch chan<- prometheus.Metric) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	status, err := e.client.Status()
+	if err != nil {
+		e.meta.Ui.Error(fmt.Sprintf("Error reading status: %s", err.Error()))
+		ch <- prometheus.MustNewConstMetric(exporterUp, prometheus.GaugeValue, 0)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(exporterUp, prometheus.GaugeValue, 1)
+	set := status.Set
+
+	for _, member := range status.Members {
+		var usable float64
+		if replset.Healthy(member) {
+			usable = 1
+		}
+		ch <- prometheus.MustNewConstMetric(exporterMemberState, prometheus.GaugeValue,
+			float64(member.State), set, member.Name)
+		ch <- prometheus.MustNewConstMetric(exporterMemberHealth, prometheus.GaugeValue,
+			member.Health, set, member.Name)
+		ch <- prometheus.MustNewConstMetric(exporterMemberUsable, prometheus.GaugeValue,
+			usable, set, member.Name)
+		ch <- prometheus.MustNewConstMetric(exporterMemberLag, prometheus.GaugeValue,
+			replset.Lag(status, member).Seconds(), set, member.Name)
+		ch <- prometheus.MustNewConstMetric(exporterMemberPing, prometheus.GaugeValue,
+			float64(member.PingMs)/1000, set, member.Name)
+	}
+
+	if primary := replset.Primary(status); primary != nil {
+		if len(e.primary) > 0 && e.primary != primary.Name {
+			e.elections++
+		}
+		e.primary = primary.Name
+
+		if oplog, err := e.client.OplogWindow(); err == nil {
+			ch <- prometheus.MustNewConstMetric(exporterOplogWindow, prometheus.GaugeValue,
+				oplog.Duration().Seconds(), set)
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(exporterElections, prometheus.CounterValue, e.elections, set)
+
+	config, err := e.client.GetConfig()
+	if err != nil {
+		e.meta.Ui.Error(fmt.Sprintf("Error reading config: %s", err.Error()))
+		return
+	}
+	quorum := replset.NewQuorum(config, status)
+	ch <- prometheus.MustNewConstMetric(exporterConfigVersion, prometheus.GaugeValue, float64(config.Version), set)
+	ch <- prometheus.MustNewConstMetric(exporterConfigMembers, prometheus.GaugeValue, float64(len(config.Members)), set)
+	ch <- prometheus.MustNewConstMetric(exporterVoters, prometheus.GaugeValue, float64(quorum.Voters), set)
+	ch <- prometheus.MustNewConstMetric(exporterHealthyVoters, prometheus.GaugeValue, float64(quorum.Healthy), set)
+
+	d, err := e.meta.Discovery()
+	if err != nil || d == nil {
+		return
+	}
+	registered, err := d.Lookup(e.meta.serviceName)
+	if err != nil {
+		e.meta.Ui.Error(fmt.Sprintf("Error reading discovery: %s", err.Error()))
+		return
+	}
+	unregistered, stale := registrationDrift(config, registered)
+	ch <- prometheus.MustNewConstMetric(exporterUnregistered, prometheus.GaugeValue, float64(len(unregistered)), set)
+	ch <- prometheus.MustNewConstMetric(exporterStale, prometheus.GaugeValue, float64(len(stale)), set)
+}
+
+func (c *ExporterCommand) Help() string {
+	helpText := `
+Usage: mongoctl exporter [options]
+  Serve Prometheus metrics for a Mongo Replica Set.
+  This command connects to a Mongo server and serves the state of each
+  member, replication lag, the oplog window, the configuration version
+  and, with a discovery backend, how registrations differ from the
+  members of the set. The set is read on every scrape.
+
+General Options:
+  ` + generalOptionsUsage() + `
+
+Exporter Options:
+
+  -username=username      The username to authenticate with if required.
+
+  -listen=addr            The address to serve metrics on.
+                          Defaults to :9216.
+
+  -path=path              The path metrics are served under, which must
+                          start with /. Any other path shows a page
+                          linking to the metrics. Defaults to /metrics.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *ExporterCommand) Synopsis() string {
+	return "Serve Prometheus metrics for a replica set"
+}
@@ -0,0 +1,83 @@
+package command
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aocsolutions/mongoctl/replset"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestExporterMux(t *testing.T) {
+	client, _ := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+	)
+	meta, _ := testMeta(client, nil)
+
+	cases := []struct {
+		path    string
+		request string
+		body    string
+	}{
+		{"/metrics", "/metrics", "mongoctl_up 1"},
+		{"/metrics", "/", `<a href="/metrics">`},
+		{"/", "/", "mongoctl_up 1"},
+	}
+
+	for _, tc := range cases {
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(newExporter(&meta, client))
+		mux := newExporterMux(registry, tc.path)
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", tc.request, nil))
+		if w.Code != 200 {
+			t.Errorf("%s %s: expected 200, got %d", tc.path, tc.request, w.Code)
+		}
+		if body := w.Body.String(); !strings.Contains(body, tc.body) {
+			t.Errorf("%s %s: expected %q in:\n%s", tc.path, tc.request, tc.body, body)
+		}
+	}
+}
+
+func TestExporterCommand_badPath(t *testing.T) {
+	client, _ := testSet(testMember{"10.0.0.1:27017", replset.StatePrimary, 1})
+	meta, _ := testMeta(client, nil)
+	c := &ExporterCommand{Meta: meta}
+
+	if code := c.Run([]string{"-path", "metrics"}); code != 1 {
+		t.Fatalf("expected failure, got %d", code)
+	}
+}
+
+func TestExporter_health(t *testing.T) {
+	client, _ := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateRecovering, 1},
+		testMember{"10.0.0.3:27017", replset.StateDown, 1},
+	)
+	client.State.Members[0].Health = 1
+	client.State.Members[1].Health = 1
+	meta, _ := testMeta(client, nil)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(newExporter(&meta, client))
+	w := httptest.NewRecorder()
+	newExporterMux(registry, "/metrics").ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := w.Body.String()
+	for _, line := range []string{
+		`mongoctl_member_health{member="10.0.0.1:27017",set="rs0"} 1`,
+		`mongoctl_member_health{member="10.0.0.2:27017",set="rs0"} 1`,
+		`mongoctl_member_health{member="10.0.0.3:27017",set="rs0"} 0`,
+		`mongoctl_member_usable{member="10.0.0.1:27017",set="rs0"} 1`,
+		`mongoctl_member_usable{member="10.0.0.2:27017",set="rs0"} 0`,
+		`mongoctl_member_usable{member="10.0.0.3:27017",set="rs0"} 0`,
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("expected %q in:\n%s", line, body)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package command
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// kvFlag is a flag.Value which collects repeated key=value flags
+// into a map.
+type kvFlag map[string]string
+
+func (v *kvFlag) String() string {
+	keys := make([]string, 0, len(*v))
+	for k := range *v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, (*v)[k]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (v *kvFlag) Set(raw string) error {
+	idx := strings.Index(raw, "=")
+	if idx <= 0 {
+		return fmt.Errorf("No '=' value in arg: %s", raw)
+	}
+	if *v == nil {
+		*v = make(map[string]string)
+	}
+	(*v)[raw[:idx]] = raw[idx+1:]
+	return nil
+}
@@ -0,0 +1,181 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/mitchellh/cli"
+	"gopkg.in/yaml.v2"
+)
+
+// Formatter writes the result of a command to the Ui.
+type Formatter interface {
+	Output(ui cli.Ui, data interface{}) error
+}
+
+// Formatters are the output formats selectable with -format. The
+// template format is built from -template when it is used.
+var Formatters = map[string]Formatter{
+	"json":  JsonFormatter{},
+	"yaml":  YamlFormatter{},
+	"table": TableFormatter{},
+}
+
+// tableOutput is implemented by command results to give their human
+// readable layout for the table format.
+type tableOutput interface {
+	Table() string
+}
+
+// An output format for JSON output
+type JsonFormatter struct{}
+
+func (j JsonFormatter) Output(ui cli.Ui, data interface{}) error {
+	b, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	ui.Output(string(b))
+	return nil
+}
+
+// An output format for YAML output
+type YamlFormatter struct{}
+
+func (y YamlFormatter) Output(ui cli.Ui, data interface{}) error {
+	b, err := yaml.Marshal(data)
+	if err != nil {
+		return err
+	}
+	ui.Output(strings.TrimSpace(string(b)))
+	return nil
+}
+
+// An output format for the human readable output of each command
+type TableFormatter struct{}
+
+func (t TableFormatter) Output(ui cli.Ui, data interface{}) error {
+	table, ok := data.(tableOutput)
+	if !ok {
+		return fmt.Errorf("No table format for %T", data)
+	}
+	if out := strings.TrimRight(table.Table(), "\n"); len(out) > 0 {
+		ui.Output(out)
+	}
+	return nil
+}
+
+// An output format which executes a text/template with the result
+type TemplateFormatter struct {
+	Template *template.Template
+}
+
+func (t TemplateFormatter) Output(ui cli.Ui, data interface{}) error {
+	var buf bytes.Buffer
+	if err := t.Template.Execute(&buf, data); err != nil {
+		return err
+	}
+	ui.Output(strings.TrimRight(buf.String(), "\n"))
+	return nil
+}
+
+// formatTable lays out rows in aligned columns, the first row being
+// the header.
+func formatTable(rows [][]string) string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// formatFlag is a flag.Value which only accepts the known formats.
+type formatFlag string
+
+func (f *formatFlag) String() string {
+	return string(*f)
+}
+
+func (f *formatFlag) Set(raw string) error {
+	if _, ok := Formatters[raw]; !ok && raw != "template" {
+		return fmt.Errorf("Unknown format %q, must be one of json, yaml, table or template", raw)
+	}
+	*f = formatFlag(raw)
+	return nil
+}
+
+// formatUi keeps stdout for the result of a command when a machine
+// readable format is selected, sending informational messages to the
+// error writer instead.
+type formatUi struct {
+	cli.Ui
+	meta *Meta
+}
+
+func (u *formatUi) Output(message string) {
+	if u.machine() {
+		u.Ui.Error(message)
+		return
+	}
+	u.Ui.Output(message)
+}
+
+func (u *formatUi) Info(message string) {
+	if u.machine() {
+		u.Ui.Error(message)
+		return
+	}
+	u.Ui.Info(message)
+}
+
+func (u *formatUi) machine() bool {
+	return u.meta.machineFormat()
+}
+
+// machineFormat returns whether the selected format is meant for
+// programs rather than people.
+func (m *Meta) machineFormat() bool {
+	return m.format != "table" || len(m.template) > 0
+}
+
+// formatter returns the Formatter selected with -format and -template.
+func (m *Meta) formatter() (Formatter, error) {
+	if m.format == "template" || len(m.template) > 0 {
+		if len(m.template) == 0 {
+			return nil, fmt.Errorf("-format=template requires -template")
+		}
+		tmpl, err := template.New("output").Parse(m.template)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing template: %s", err)
+		}
+		return TemplateFormatter{Template: tmpl}, nil
+	}
+
+	return Formatters[string(m.format)], nil
+}
+
+// output writes the result of a command in the selected format,
+// returning the exit code.
+func (m *Meta) output(data interface{}) int {
+	ui := m.Ui
+	if u, ok := ui.(*formatUi); ok {
+		ui = u.Ui
+	}
+
+	formatter, err := m.formatter()
+	if err != nil {
+		m.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+	if err := formatter.Output(ui, data); err != nil {
+		m.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+	return 0
+}
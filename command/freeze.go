@@ -0,0 +1,85 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+)
+
+type FreezeCommand struct {
+	Meta
+}
+
+func (c *FreezeCommand) Run(args []string) int {
+	var username string
+	var seconds int
+	flags := c.Meta.FlagSet("freeze", FlagSetDefault)
+	flags.Usage = func() { c.Ui.Error(c.Help()) }
+	flags.StringVar(&username, "username", "", "")
+	flags.IntVar(&seconds, "seconds", 60, "")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	hosts := flags.Args()
+	if len(hosts) == 0 {
+		c.Ui.Error("Error: at least one member to freeze must be given")
+		c.Ui.Error(c.Help())
+		return 1
+	}
+
+	code := 0
+	out := &freezeOutput{
+		Hosts:   []string{},
+		Seconds: seconds,
+	}
+	for _, host := range hosts {
+		client, err := c.Meta.dial(host, username, true)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s: %s", host, err.Error()))
+			code = 1
+			continue
+		}
+		err = client.Freeze(seconds)
+		client.Close()
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s: %s", host, err.Error()))
+			code = 1
+			continue
+		}
+
+		if seconds == 0 {
+			c.Ui.Info(fmt.Sprintf("Unfroze %s", host))
+		} else {
+			c.Ui.Info(fmt.Sprintf("Froze %s for %d seconds", host, seconds))
+		}
+		out.Hosts = append(out.Hosts, host)
+	}
+	if c.Meta.output(out) != 0 {
+		return 1
+	}
+	return code
+}
+
+func (c *FreezeCommand) Help() string {
+	helpText := `
+Usage: mongoctl freeze [options] host:port...
+  Prevent members of a Mongo Replica Set from seeking election.
+  This command connects to each given member and runs replSetFreeze,
+  so that it will not become primary for the given time.
+
+General Options:
+  ` + generalOptionsUsage() + `
+
+Freeze Options:
+
+  -username=username      The username to authenticate with if required.
+
+  -seconds=seconds        How long the members are frozen for, 0 unfreezes
+                          them. Defaults to 60.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *FreezeCommand) Synopsis() string {
+	return "Prevent members from seeking election"
+}
@@ -5,8 +5,9 @@ import (
 	"strings"
 	"time"
 
-	"gopkg.in/mgo.v2"
-	"gopkg.in/mgo.v2/bson"
+	"github.com/aocsolutions/mongoctl/discovery"
+	"github.com/aocsolutions/mongoctl/replset"
+	"github.com/nevins-b/commgo"
 )
 
 type InitCommand struct {
@@ -14,95 +15,207 @@ type InitCommand struct {
 }
 
 func (c *InitCommand) Run(args []string) int {
-	var username string
-	flags := c.Meta.FlagSet("init", FlagSetDefault)
+	var port int
+	var ec2 bool
+	var addr, username string
+	var timeout time.Duration
+	var member memberFlags
+	flags := c.Meta.FlagSet("init", FlagSetDefault|FlagSetDryRun)
 	flags.Usage = func() { c.Ui.Error(c.Help()) }
 	flags.StringVar(&username, "username", "", "")
+	flags.IntVar(&port, "port", 27017, "")
+	flags.StringVar(&addr, "addr", "", "")
+	flags.BoolVar(&ec2, "ec2", false, "")
+	flags.DurationVar(&timeout, "timeout", 30*time.Second, "")
+	member.register(flags)
 
 	if err := flags.Parse(args); err != nil {
 		return 1
 	}
 
-	node, err := c.Meta.GetNode()
-	if err != nil {
-		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
-		return 1
+	if len(addr) == 0 && ec2 {
+		ip, err := c.Meta.GetLocalIP()
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+			return 1
+		}
+		addr = ip
 	}
-	info := &mgo.DialInfo{
-		Addrs:    []string{node},
-		Timeout:  5 * time.Second,
-		Username: username,
-		Direct:   true,
+
+	// There are no members to discover yet, so connect to the
+	// node being initialized or the -mongo server.
+	node := c.Meta.mongoServer
+	if len(addr) > 0 {
+		node = fmt.Sprintf("%s:%d", addr, port)
 	}
 
-	if len(username) > 0 {
-		info.Password, _ = c.Ui.Ask("Password: ")
+	// The member flags are applied to the only member once the set is
+	// initiated, so check it would still be electable beforehand.
+	if member.given() {
+		config := &commgo.RsConf{Members: []*commgo.Host{member.host(0, node)}}
+		if err := replset.ValidateConfig(config); err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+			return 1
+		}
 	}
-	session, err := mgo.DialWithInfo(info)
+
+	// Connect directly since we are working
+	// with a single node not a cluster yet
+	client, err := c.Meta.dial(node, username, true)
 	if err != nil {
 		c.Ui.Error(err.Error())
 		return 1
 	}
+	defer client.Close()
 
-	// This needs to be set since we are working
-	// with a single node not a cluster yet
-	session.SetMode(mgo.Monotonic, true)
-
-	defer session.Close()
-	cmd := &bson.M{
-		"replSetInitiate": ""}
-	result := bson.M{}
-
-	if err := session.DB("admin").Run(&cmd, &result); err != nil {
+	result, err := client.Initiate()
+	if err != nil {
 		c.Ui.Error(err.Error())
 		return 1
 	}
-
-	if c.Meta.consul {
-		addr, err := c.Meta.GetLocalIP()
-		port := 27017
-		if err != nil {
+	if member.given() {
+		if err := c.configure(client, &member, node, timeout); err != nil {
 			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
 			return 1
 		}
-		err = c.Meta.consulAgent.AddService(
-			addr,
-			fmt.Sprintf("%s:%d", addr, port),
-			fmt.Sprintf("/bin/nc -zv %s %d", addr, port),
-			"mongodb",
-			port,
-		)
+	}
+
+	out := &initOutput{
+		Host:       node,
+		Registered: []string{},
+		DryRun:     c.Meta.dryRun,
+		Result:     result,
+	}
+
+	d, err := c.Meta.Discovery()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+	if d != nil {
+		if len(addr) == 0 {
+			addr, err = c.Meta.GetLocalIP()
+			if err != nil {
+				c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+				return 1
+			}
+		}
+		service := &discovery.Service{
+			ID:   fmt.Sprintf("%s:%d", addr, port),
+			Addr: addr,
+			Port: port,
+		}
+		if !c.Meta.dryRun {
+			c.tag(client, service, timeout)
+		}
+		ok, err := c.Meta.register(d, service)
 		if err != nil {
 			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
 			return 1
 		}
+		if ok {
+			out.Registered = append(out.Registered, service.ID)
+		}
+	}
+	return c.Meta.output(out)
+}
+
+// tag waits for the new set to elect its primary and tags service with
+// its role, as add and agent do. A member which isn't elected in time is
+// registered without tags, which agent corrects once it is.
+func (c *InitCommand) tag(client replset.Client, service *discovery.Service, timeout time.Duration) {
+	c.Ui.Info("Waiting for a primary to be elected")
+	if _, err := replset.WaitForPrimaryOf(client, nil, timeout); err != nil {
+		c.Ui.Error(fmt.Sprintf("Warning: %s, registering without a role", err.Error()))
+		return
+	}
+	config, err := client.GetConfig()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Warning: %s, registering without a role", err.Error()))
+		return
+	}
+	status, err := client.Status()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Warning: %s, registering without a role", err.Error()))
+		return
 	}
 
-	out := fmt.Sprintf("%v", result)
-	c.Ui.Output(out)
-	return 0
+	// The set was initiated with just this member, which it may know
+	// by its hostname rather than the registered address.
+	host := service.String()
+	if len(config.Members) == 1 {
+		host = config.Members[0].Host
+	}
+	c.Meta.describeAs(service, host, config, status)
+}
+
+// configure applies the member flags to the only member of a newly
+// initiated set once it is primary, waiting up to timeout. With
+// -dry-run the set isn't initiated, so the config is assumed to hold
+// just node.
+func (c *InitCommand) configure(client replset.Client, member *memberFlags, node string, timeout time.Duration) error {
+	config := &commgo.RsConf{
+		Version: 1,
+		Members: []*commgo.Host{{ID: 0, Host: node}},
+	}
+	if !c.Meta.dryRun {
+		// replSetReconfig is only accepted by a primary, which the
+		// new set elects shortly after it is initiated.
+		c.Ui.Info("Waiting for a primary to be elected")
+		if _, err := replset.WaitForPrimaryOf(client, nil, timeout); err != nil {
+			return err
+		}
+		var err error
+		if config, err = client.GetConfig(); err != nil {
+			return err
+		}
+		if len(config.Members) != 1 {
+			return fmt.Errorf("Expected one member after initiating, found %d", len(config.Members))
+		}
+	}
+
+	have := config.Members[0]
+	config.Members[0] = member.host(have.ID, have.Host)
+	if err := replset.ValidateConfig(config); err != nil {
+		return err
+	}
+	c.Ui.Info(fmt.Sprintf("Configuring %s", have.Host))
+	return client.Reconfig(config)
 }
 
 func (c *InitCommand) Help() string {
 	helpText := `
 Usage: mongoctl init [options]
   Initialize a new Mongo Replica Set.
-  This command connects to a Mongo server and initilizes a cluster.
+  This command connects to a Mongo server and initilizes a cluster. Any
+  member options are applied to the host with a reconfig once the set
+  is initiated.
 
 General Options:
-  -mongo=addr             The address of the Mongo server if not using Consul.
-
-  -consul-service=service The service name to use when looking up Mongo
-	                        with consul.
-
-	-consul-server=addr			The address of the consul server to use,
-	                        this defaults to 127.0.0.1:8500.
-  -consul                 Use consul to find Mongo
+  ` + generalOptionsUsage() + `
 
 Init Options:
 
 	-username=username      The username to authenticate with if required.
 
+  -addr=addr              The address of the host to initialize and
+                          register. Defaults to the -mongo server, and the
+                          EC2 address when registering.
+
+  -port=port              The port of the host to initialize.
+                          Defaults to 27017.
+
+  -ec2                    If the host is an EC2 instance, discover its
+                          address from the instance metadata.
+
+  -timeout=duration       How long to wait for the host to be elected
+                          primary, so the member options can be applied
+                          and its registration is tagged with its role.
+                          Defaults to 30s.
+
+  ` + memberOptionsUsage() + `
+
+  ` + dryRunOptionsUsage() + `
 `
 	return strings.TrimSpace(helpText)
 }
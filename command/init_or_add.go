@@ -1,96 +1,208 @@
 package command
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aocsolutions/mongoctl/discovery"
+	"github.com/aocsolutions/mongoctl/replset"
+)
 
 type InitOrAddCommand struct {
 	Meta
 }
 
 func (c *InitOrAddCommand) Run(args []string) int {
-	var priority, port int
-	var hidden, arbitrator, ec2 bool
+	var port int
+	var ec2 bool
 	var addr, username string
-	flags := c.Meta.FlagSet("initoradd", FlagSetDefault)
+	var lockWait time.Duration
+	var member memberFlags
+	flags := c.Meta.FlagSet("initoradd", FlagSetDefault|FlagSetDryRun)
 	flags.Usage = func() { c.Ui.Error(c.Help()) }
-	flags.IntVar(&priority, "priority", 1, "")
 	flags.IntVar(&port, "port", 27017, "")
 	flags.StringVar(&addr, "addr", "", "")
 	flags.StringVar(&username, "username", "", "")
-	flags.BoolVar(&hidden, "hidden", false, "")
-	flags.BoolVar(&arbitrator, "arbitrator", false, "")
 	flags.BoolVar(&ec2, "ec2", false, "")
+	member.register(flags)
+	flags.DurationVar(&lockWait, "lock-wait", 30*time.Second, "")
 	if err := flags.Parse(args); err != nil {
 		return 1
 	}
 
-	nodes, err := c.Meta.consulAgent.GetService(
-		c.Meta.consulKey,
-		"",
-	)
+	if len(addr) == 0 && ec2 {
+		ip, err := c.Meta.GetLocalIP()
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+			return 1
+		}
+		addr = ip
+	}
+
+	if err := replset.ValidateMember(member.host(0, fmt.Sprintf("%s:%d", addr, port))); err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+
+	d, err := c.Meta.Discovery()
 	if err != nil {
 		c.Ui.Error(err.Error())
 		return 1
 	}
-	if len(nodes) == 0 {
-		c.Ui.Info("No nodes found in consul, running init")
+	if d == nil {
+		c.Ui.Error("Error: initoradd requires a discovery backend")
+		return 1
+	}
+
+	// Hold the cluster lock while deciding between init and add and
+	// registering, so hosts booting together don't each initialize
+	// their own replica set.
+	if locker, ok := d.(discovery.Locker); ok && !c.Meta.dryRun {
+		c.Ui.Info("Acquiring cluster lock")
+		unlock, err := locker.Lock(c.Meta.serviceName, lockWait)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+			return 1
+		}
+		defer func() {
+			if err := unlock(); err != nil {
+				c.Ui.Error(fmt.Sprintf("Error releasing cluster lock: %s", err.Error()))
+			}
+		}()
+	}
+	args = filterArgs(args, "lock-wait")
+
+	nodes, err := d.Lookup(c.Meta.serviceName)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
+	initialize := len(nodes) == 0
+	if seeder, ok := d.(discovery.Seeder); ok {
+		// Listed members don't imply a running cluster, so the seed
+		// initializes the set unless another member already has.
+		seed, err := seeder.Seed(c.Meta.serviceName)
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		initialize = seed != nil && seed.Addr == addr && seed.Port == port &&
+			!c.initialized(nodes, seed, username)
+	}
+
+	if initialize {
+		c.Ui.Info("No nodes found in discovery, running init")
 		cmd := &InitCommand{
 			Meta: c.Meta,
 		}
 		return cmd.Run(args)
-	} else {
-		c.Ui.Info("Cluster Found, adding node")
-		cmd := &AddCommand{
-			Meta: c.Meta,
+	}
+
+	// Apply the role of this node if the backend records one
+	if self := discovery.Find(nodes, addr, port); self != nil {
+		if self.HasTag("arbiter") && !member.arbitrator {
+			args = append(args, "-arbitrator")
+		}
+		if self.HasTag("hidden") && !member.hidden {
+			args = append(args, "-hidden")
 		}
-		return cmd.Run(args)
 	}
 
+	c.Ui.Info("Cluster Found, adding node")
+	cmd := &AddCommand{
+		Meta: c.Meta,
+	}
+	return cmd.Run(args)
+}
+
+// initialized returns whether any of nodes other than self is already
+// a member of an initialized replica set.
+func (c *InitOrAddCommand) initialized(nodes []*discovery.Service, self *discovery.Service, username string) bool {
+	for _, node := range nodes {
+		if node.String() == self.String() {
+			continue
+		}
+		client, err := c.Meta.dial(node.String(), username, true)
+		if err != nil {
+			continue
+		}
+		_, err = client.GetConfig()
+		client.Close()
+		if err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// filterArgs removes the named flags, and their values, from args.
+func filterArgs(args []string, names ...string) []string {
+	var out []string
+	for i := 0; i < len(args); i++ {
+		name := strings.TrimLeft(args[i], "-")
+		value := strings.Contains(name, "=")
+		if value {
+			name = name[:strings.Index(name, "=")]
+		}
+
+		skip := false
+		for _, n := range names {
+			if name == n {
+				skip = true
+				break
+			}
+		}
+		if !skip {
+			out = append(out, args[i])
+			continue
+		}
+
+		// Skip the value of non boolean flags given as "-flag value"
+		if !value && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			i++
+		}
+	}
+	return out
 }
 
 func (c *InitOrAddCommand) Help() string {
 	helpText := `
-Usage: mongoctl add [options]
-  Add a node to an existing Mongo Replica Set.
-  This command connects to a Mongo server and adds the specified host to an
-  existing cluster. If consul is specified this command will also register
-  the added host to the Mongo service in consul.
+Usage: mongoctl initoradd [options]
+  Initialize a new Mongo Replica Set or add a node to an existing one.
+  This command looks up the Mongo service in the discovery backend. If no
+  nodes are registered it runs init for the specified host, otherwise it
+  adds the host to the existing cluster. A discovery backend is required.
 
 General Options:
-  -mongo=addr             The address of the Mongo server if not using Consul.
-
-  -consul-service=service The service name to use when looking up Mongo
-                          with consul.
-
-  -consul-server=addr     The address of the consul server to use,
-                          this defaults to 127.0.0.1:8500.
-  -consul                 Use consul to find Mongo
+  ` + generalOptionsUsage() + `
 
-Init Options:
+Init Or Add Options:
 
   -username=username      The username to authenticate with if required.
 
-  -addr=addr              The address of the host to add.
+  -addr=addr              The address of the host to initialize or add.
 
-  -port=port              The port of the host to add.
+  -port=port              The port of the host to initialize or add.
                           Defaults to 27017.
 
-  -priority=priority      The priority of the host to add.
-                          Defaults to 1.
+  ` + memberOptionsUsage() + `
 
-  -hidden                 If the host should be added hidden.
-                          Defaults to False.
+  -ec2                    If the host is an EC2 instance.
+                          This can be used to discover the address of the
+                          instance, assuming the command is run on the
+                          instance that is being initialized or added.
 
-  -arbitrator             If the host should be added as an arbitrator.
-                          Defaults to False.
+  -lock-wait=duration     How long to wait for the cluster lock when the
+                          discovery backend supports locking.
+                          Defaults to 30s.
 
-  -ec2                    If the host to be added is an EC2 instance.
-                          This can be used to discover the address of the
-                          instance to add, assuming the command is run on the
-													instance that is being added.
+  ` + dryRunOptionsUsage() + `
 `
 	return strings.TrimSpace(helpText)
 }
 
 func (c *InitOrAddCommand) Synopsis() string {
-	return "Add a node to an existing mongo cluster"
+	return "Initialize a new mongo cluster or add a node to an existing one"
 }
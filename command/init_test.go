@@ -0,0 +1,70 @@
+package command
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aocsolutions/mongoctl/replset"
+)
+
+func TestInitCommand(t *testing.T) {
+	client := &replset.Memory{Self: "10.0.0.1:27017"}
+	d := &testDiscovery{}
+	meta, ui := testMeta(client, d)
+	c := &InitCommand{Meta: meta}
+
+	if code := c.Run([]string{"-addr", "10.0.0.1"}); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+	if len(client.Reconfigs) != 0 {
+		t.Fatalf("expected no reconfig without member flags, got %d", len(client.Reconfigs))
+	}
+
+	services, _ := d.Lookup("mongodb")
+	if len(services) != 1 || services[0].ID != "10.0.0.1:27017" {
+		t.Fatalf("bad registrations: %v", services)
+	}
+	if !reflect.DeepEqual(services[0].Tags, []string{"primary"}) {
+		t.Fatalf("expected the registration to be tagged primary, got %v", services[0].Tags)
+	}
+}
+
+func TestInitCommand_memberFlags(t *testing.T) {
+	client := &replset.Memory{Self: "10.0.0.1:27017"}
+	d := &testDiscovery{}
+	meta, ui := testMeta(client, d)
+	c := &InitCommand{Meta: meta}
+
+	args := []string{"-addr", "10.0.0.1", "-priority", "2", "-tag", "dc=east"}
+	if code := c.Run(args); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+
+	if len(client.Reconfigs) != 1 {
+		t.Fatalf("expected one reconfig, got %d", len(client.Reconfigs))
+	}
+	member := client.Config.Members[0]
+	if member.Host != "10.0.0.1:27017" || member.Priority != 2 || member.Tags["dc"] != "east" {
+		t.Fatalf("member flags not applied: %#v", member)
+	}
+	if ids := d.ids("mongodb"); !reflect.DeepEqual(ids, []string{"10.0.0.1:27017"}) {
+		t.Fatalf("expected the member to be registered, got %v", ids)
+	}
+}
+
+func TestInitCommand_unelectable(t *testing.T) {
+	client := &replset.Memory{Self: "10.0.0.1:27017"}
+	d := &testDiscovery{}
+	meta, _ := testMeta(client, d)
+	c := &InitCommand{Meta: meta}
+
+	if code := c.Run([]string{"-addr", "10.0.0.1", "-hidden"}); code != 1 {
+		t.Fatalf("expected failure, got %d", code)
+	}
+	if client.Config != nil {
+		t.Fatalf("expected the set not to be initiated, got %#v", client.Config)
+	}
+	if ids := d.ids("mongodb"); len(ids) != 0 {
+		t.Fatalf("expected no registration, got %v", ids)
+	}
+}
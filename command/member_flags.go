@@ -0,0 +1,116 @@
+package command
+
+import (
+	"flag"
+	"strings"
+	"time"
+
+	"github.com/nevins-b/commgo"
+)
+
+// memberFlagNames are the flags registered by memberFlags.
+var memberFlagNames = []string{
+	"priority", "votes", "hidden", "arbitrator",
+	"build-indexes", "slave-delay", "tag",
+}
+
+// memberFlags are the flags that describe how a member is configured
+// in the replica set.
+type memberFlags struct {
+	priority     float64
+	votes        int
+	hidden       bool
+	arbitrator   bool
+	buildIndexes bool
+	slaveDelay   time.Duration
+	tags         kvFlag
+
+	flags *flag.FlagSet
+}
+
+func (m *memberFlags) register(flags *flag.FlagSet) {
+	m.flags = flags
+	flags.Float64Var(&m.priority, "priority", 1, "")
+	flags.IntVar(&m.votes, "votes", 1, "")
+	flags.BoolVar(&m.hidden, "hidden", false, "")
+	flags.BoolVar(&m.arbitrator, "arbitrator", false, "")
+	flags.BoolVar(&m.buildIndexes, "build-indexes", true, "")
+	flags.DurationVar(&m.slaveDelay, "slave-delay", 0, "")
+	flags.Var(&m.tags, "tag", "")
+}
+
+// isSet returns whether the named flag was given on the command line.
+func (m *memberFlags) isSet(name string) bool {
+	set := false
+	m.flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// given returns whether any member flag was given on the command line.
+func (m *memberFlags) given() bool {
+	for _, name := range memberFlagNames {
+		if m.isSet(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// host returns the configuration of a new member. Members which can't
+// be elected default to priority 0 unless -priority is given, in which
+// case replset.ValidateMember reports the conflict.
+func (m *memberFlags) host(id int64, host string) *commgo.Host {
+	cfg := &commgo.Host{
+		ID:           id,
+		Host:         host,
+		ArbiterOnly:  m.arbitrator,
+		BuildIndexes: m.buildIndexes,
+		Hidden:       m.hidden,
+		Priority:     m.priority,
+		SlaveDelay:   int64(m.slaveDelay / time.Second),
+		Votes:        m.votes,
+		Tags:         map[string]string(m.tags),
+	}
+	if !m.isSet("priority") && m.unelectable() {
+		cfg.Priority = 0
+	}
+	return cfg
+}
+
+// unelectable returns whether the flags describe a member which can
+// never become primary.
+func (m *memberFlags) unelectable() bool {
+	return m.arbitrator || m.hidden || m.votes == 0 ||
+		!m.buildIndexes || m.slaveDelay > 0
+}
+
+// memberOptionsUsage returns the usage documentation for memberFlags.
+func memberOptionsUsage() string {
+	member := `
+  -priority=priority      The priority of the host to add.
+                          Defaults to 1, or 0 if the host can not be
+                          elected.
+
+  -votes=votes            The number of votes of the host, 0 or 1.
+                          Defaults to 1.
+
+  -hidden                 If the host should be added hidden, which
+                          forces priority 0. Defaults to False.
+
+  -arbitrator             If the host should be added as an arbitrator.
+                          Defaults to False.
+
+  -build-indexes=bool     If the host should build indexes.
+                          Defaults to True.
+
+  -slave-delay=duration   How far the host should lag behind the primary,
+                          making it a delayed member.
+
+  -tag=key=value          A member tag, can be given multiple times.
+`
+	return strings.TrimSpace(member)
+}
@@ -0,0 +1,174 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aocsolutions/mongoctl/replset"
+)
+
+type MemberSetCommand struct {
+	Meta
+}
+
+func (c *MemberSetCommand) Run(args []string) int {
+	var port int
+	var ec2, yes bool
+	var addr, username string
+	var member memberFlags
+	flags := c.Meta.FlagSet("member set", FlagSetDefault)
+	flags.Usage = func() { c.Ui.Error(c.Help()) }
+	flags.IntVar(&port, "port", 27017, "")
+	flags.StringVar(&addr, "addr", "", "")
+	flags.StringVar(&username, "username", "", "")
+	flags.BoolVar(&ec2, "ec2", false, "")
+	flags.BoolVar(&yes, "yes", false, "")
+	member.register(flags)
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if len(addr) == 0 && ec2 {
+		ip, err := c.Meta.GetLocalIP()
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+			return 1
+		}
+		addr = ip
+	}
+	if len(addr) == 0 {
+		c.Ui.Error("Error: the member to change must be given with -addr")
+		return 1
+	}
+
+	if member.isSet("arbitrator") || member.isSet("build-indexes") {
+		c.Ui.Error("Error: arbitrator and build-indexes can not be changed in place, " +
+			"remove and re-add the member instead")
+		return 1
+	}
+
+	client, err := c.Meta.Client(username, false)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+	defer client.Close()
+
+	config, err := client.GetConfig()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+
+	host := fmt.Sprintf("%s:%d", addr, port)
+	i := replset.FindMember(config, host)
+	if i < 0 {
+		c.Ui.Error(fmt.Sprintf("Node %s not found in cluster", host))
+		return 1
+	}
+
+	have := config.Members[i]
+	want := *have
+	if member.isSet("votes") {
+		want.Votes = member.votes
+	}
+	if member.isSet("hidden") {
+		want.Hidden = member.hidden
+	}
+	if member.isSet("slave-delay") {
+		want.SlaveDelay = int64(member.slaveDelay / time.Second)
+	}
+	if member.isSet("tag") {
+		want.Tags = map[string]string(member.tags)
+	}
+	if member.isSet("priority") {
+		want.Priority = member.priority
+	} else if want.Hidden || want.SlaveDelay > 0 || want.Votes == 0 {
+		want.Priority = 0
+	}
+
+	fields := replset.DiffMember(have, &want)
+	if len(fields) == 0 {
+		c.Ui.Output(fmt.Sprintf("No changes to %s", host))
+		return c.Meta.output(newChangeOutput(config, false))
+	}
+
+	config.Members[i] = &want
+	if err := replset.ValidateConfig(config); err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+
+	c.Ui.Output(fmt.Sprintf("~ %s", host))
+	for _, field := range fields {
+		c.Ui.Output(fmt.Sprintf("    %s", field))
+	}
+
+	if !yes {
+		ok, err := c.Meta.confirm("Apply these changes?")
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+			return 1
+		}
+		if !ok {
+			c.Ui.Info("Change cancelled.")
+			return 1
+		}
+	}
+
+	if err := client.Reconfig(config); err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+
+	out := newChangeOutput(config, false)
+	out.Changed = append(out.Changed, host)
+	return c.Meta.output(out)
+}
+
+func (c *MemberSetCommand) Help() string {
+	helpText := `
+Usage: mongoctl member set [options]
+  Change the configuration of an existing member of a Mongo Replica Set.
+  This command connects to a Mongo server, applies the given settings to
+  the member, shows the changes and reconfigures the set once confirmed.
+  Only the settings given are changed. Hidden, delayed and non-voting
+  members are given priority 0 unless -priority is set.
+
+General Options:
+  ` + generalOptionsUsage() + `
+
+Member Set Options:
+
+  -username=username      The username to authenticate with if required.
+
+  -addr=addr              The address of the member to change.
+
+  -port=port              The port of the member to change.
+                          Defaults to 27017.
+
+  -ec2                    Discover the address of the member from the EC2
+                          instance metadata, assuming the command is run
+                          on the instance being changed.
+
+  -yes                    Apply without asking for confirmation.
+
+  -priority=priority      The priority of the member.
+
+  -votes=votes            The number of votes of the member, 0 or 1.
+
+  -hidden=bool            If the member is hidden.
+
+  -slave-delay=duration   How far the member should lag behind the
+                          primary, 0 to remove the delay.
+
+  -tag=key=value          A member tag, can be given multiple times. The
+                          given tags replace all existing tags.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *MemberSetCommand) Synopsis() string {
+	return "Change an existing member of a replica set"
+}
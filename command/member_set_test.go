@@ -0,0 +1,115 @@
+package command
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aocsolutions/mongoctl/replset"
+)
+
+func TestMemberSetCommand(t *testing.T) {
+	client, d := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+		testMember{"10.0.0.3:27017", replset.StateSecondary, 1},
+	)
+	meta, ui := testMeta(client, d)
+	c := &MemberSetCommand{Meta: meta}
+
+	args := []string{"-addr", "10.0.0.3", "-priority", "2", "-tag", "dc=east", "-yes"}
+	if code := c.Run(args); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+
+	if len(client.Reconfigs) != 1 {
+		t.Fatalf("expected one reconfig, got %d", len(client.Reconfigs))
+	}
+	member := client.Config.Members[2]
+	if member.Priority != 2 || !reflect.DeepEqual(member.Tags, map[string]string{"dc": "east"}) {
+		t.Fatalf("member settings not applied: %#v", member)
+	}
+	if member.Votes != 1 || member.Hidden {
+		t.Fatalf("expected the other settings to be kept: %#v", member)
+	}
+}
+
+func TestMemberSetCommand_hidden(t *testing.T) {
+	client, d := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+		testMember{"10.0.0.3:27017", replset.StateSecondary, 1},
+	)
+	meta, ui := testMeta(client, d)
+	c := &MemberSetCommand{Meta: meta}
+
+	if code := c.Run([]string{"-addr", "10.0.0.3", "-hidden", "-yes"}); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+	member := client.Config.Members[2]
+	if !member.Hidden || member.Priority != 0 {
+		t.Fatalf("expected a hidden member with priority 0, got %#v", member)
+	}
+}
+
+func TestMemberSetCommand_noChanges(t *testing.T) {
+	client, d := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+	)
+	meta, ui := testMeta(client, d)
+	c := &MemberSetCommand{Meta: meta}
+
+	if code := c.Run([]string{"-addr", "10.0.0.2", "-priority", "1"}); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+	if len(client.Reconfigs) != 0 {
+		t.Fatalf("expected no reconfig, got %d", len(client.Reconfigs))
+	}
+}
+
+func TestMemberSetCommand_cancelled(t *testing.T) {
+	client, d := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+	)
+	meta, ui := testMeta(client, d)
+	ui.InputReader = strings.NewReader("no\n")
+	c := &MemberSetCommand{Meta: meta}
+
+	if code := c.Run([]string{"-addr", "10.0.0.2", "-priority", "2"}); code != 1 {
+		t.Fatalf("expected the change to be cancelled, got %d", code)
+	}
+	if len(client.Reconfigs) != 0 {
+		t.Fatalf("expected no reconfig, got %d", len(client.Reconfigs))
+	}
+}
+
+func TestMemberSetCommand_invalid(t *testing.T) {
+	cases := []struct {
+		name string
+		args []string
+	}{
+		{"no address", []string{"-priority", "2"}},
+		{"unknown member", []string{"-addr", "10.0.0.9", "-priority", "2"}},
+		{"arbitrator", []string{"-addr", "10.0.0.2", "-arbitrator"}},
+		{"build indexes", []string{"-addr", "10.0.0.2", "-build-indexes=false"}},
+		{"invalid config", []string{"-addr", "10.0.0.2", "-votes", "2"}},
+	}
+
+	for _, tc := range cases {
+		client, d := testSet(
+			testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+			testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+		)
+		meta, _ := testMeta(client, d)
+		c := &MemberSetCommand{Meta: meta}
+
+		if code := c.Run(append(tc.args, "-yes")); code != 1 {
+			t.Errorf("%s: expected failure, got %d", tc.name, code)
+		}
+		if len(client.Reconfigs) != 0 {
+			t.Errorf("%s: expected no reconfig", tc.name)
+		}
+	}
+}
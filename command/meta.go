@@ -8,10 +8,21 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/aocsolutions/mongoctl/builtin/consul"
+	"github.com/aocsolutions/mongoctl/builtin/dns"
+	"github.com/aocsolutions/mongoctl/builtin/etcd"
+	"github.com/aocsolutions/mongoctl/builtin/inventory"
+	"github.com/aocsolutions/mongoctl/discovery"
+	"github.com/aocsolutions/mongoctl/replset"
+	"github.com/hashicorp/consul/api"
 
 	"github.com/mitchellh/cli"
+	"github.com/nevins-b/commgo"
+	"gopkg.in/mgo.v2"
 )
 
 // FlagSetFlags is an enum to define what flags are present in the
@@ -19,10 +30,11 @@ import (
 type FlagSetFlags uint
 
 const (
-	FlagSetNone    FlagSetFlags = 0
-	FlagSetServer  FlagSetFlags = 1 << iota
-	FlagSetDefault              = FlagSetServer
-	ec2MetadataURI              = "http://169.254.169.254/latest/meta-data/local-ipv4"
+	FlagSetNone   FlagSetFlags = 0
+	FlagSetServer FlagSetFlags = 1 << iota
+	FlagSetDryRun
+	FlagSetDefault = FlagSetServer
+	ec2MetadataURI = "http://169.254.169.254/latest/meta-data/local-ipv4"
 )
 
 // Meta contains the meta-options and functionality that nearly every
@@ -31,16 +43,29 @@ type Meta struct {
 	Ui cli.Ui
 
 	// The things below can be set, but aren't common
-	ForceAddress string  // Address to force for API clients
-	ForceConfig  *Config // Force a config, don't load from disk
+	ForceAddress   string              // Address to force for API clients
+	ForceConfig    *Config             // Force a config, don't load from disk
+	ForceClient    replset.Client      // Force a replica set client, don't dial
+	ForceDiscovery discovery.Discovery // Force a discovery backend
 
 	// These are set by the command line flags.
-	consulServer string
-	consulKey    string
-	consul       bool
-	mongoServer  string
-	consulAgent  *consul.Agent
-	config       *Config
+	consulConfig  consul.Agent
+	serviceName   string
+	discoveryName string
+	consul        bool
+	dnsDomain     string
+	dnsServer     string
+	etcdEndpoints string
+	etcdPrefix    string
+	etcdTTL       int64
+	mongoServer   string
+	inventory     string
+	password      string
+	dryRun        bool
+	format        formatFlag
+	template      string
+	consulAgent   *consul.Agent
+	config        *Config
 }
 
 // Config loads the configuration and returns it. If the configuration
@@ -72,11 +97,47 @@ func (m *Meta) FlagSet(n string, fs FlagSetFlags) *flag.FlagSet {
 	// FlagSetServer tells us to enable the settings for selecting
 	// the server information.
 	if fs&FlagSetServer != 0 {
-		f.StringVar(&m.consulKey, "consul-service", "mongodb", "")
+		f.StringVar(&m.serviceName, "service", "mongodb", "")
+		f.StringVar(&m.serviceName, "consul-service", "mongodb", "")
+		f.StringVar(&m.discoveryName, "discovery", "", "")
 		f.BoolVar(&m.consul, "consul", false, "")
+		f.StringVar(&m.consulConfig.Server, "consul-server", "", "")
+		f.StringVar(&m.consulConfig.Scheme, "consul-scheme", "", "")
+		f.StringVar(&m.consulConfig.Datacenter, "consul-datacenter", "", "")
+		f.StringVar(&m.consulConfig.Token, "consul-token", "", "")
+		f.StringVar(&m.consulConfig.CAFile, "consul-ca-file", "", "")
+		f.StringVar(&m.consulConfig.CertFile, "consul-cert-file", "", "")
+		f.StringVar(&m.consulConfig.KeyFile, "consul-key-file", "", "")
+		f.StringVar(&m.consulConfig.Check.Type, "consul-check", "", "")
+		f.StringVar(&m.consulConfig.Check.Interval, "consul-check-interval", "", "")
+		f.StringVar(&m.consulConfig.Check.Timeout, "consul-check-timeout", "", "")
+		f.StringVar(&m.consulConfig.Check.TTL, "consul-check-ttl", "", "")
+		f.StringVar(&m.consulConfig.Check.HTTP, "consul-check-http", "", "")
+		f.StringVar(&m.consulConfig.Check.DeregisterCriticalAfter, "consul-check-deregister", "", "")
+		f.StringVar(&m.dnsDomain, "dns-domain", "", "")
+		f.StringVar(&m.dnsServer, "dns-server", "", "")
+		f.StringVar(&m.etcdEndpoints, "etcd-endpoints", "", "")
+		f.StringVar(&m.etcdPrefix, "etcd-prefix", "", "")
+		f.Int64Var(&m.etcdTTL, "etcd-ttl", 0, "")
+		f.StringVar(&m.inventory, "inventory", "", "")
 		f.StringVar(&m.mongoServer, "mongo", "127.0.0.1:27017", "")
 	}
 
+	// FlagSetDryRun enables -dry-run for commands that change the
+	// replica set or discovery registrations.
+	if fs&FlagSetDryRun != 0 {
+		f.BoolVar(&m.dryRun, "dry-run", false, "")
+	}
+
+	// The output format is available to every command.
+	m.format = "table"
+	f.Var(&m.format, "format", "")
+	f.StringVar(&m.template, "template", "", "")
+	if u, ok := m.Ui.(*formatUi); ok {
+		m.Ui = u.Ui
+	}
+	m.Ui = &formatUi{Ui: m.Ui, meta: m}
+
 	// Create an io.Writer that writes to our Ui properly for errors.
 	// This is kind of a hack, but it does the job. Basically: create
 	// a pipe, use a scanner to break it into lines, and output each line
@@ -93,19 +154,288 @@ func (m *Meta) FlagSet(n string, fs FlagSetFlags) *flag.FlagSet {
 	return f
 }
 
-func (m *Meta) GetNode() (node string, err error) {
+// Discovery returns the discovery backend selected with -discovery,
+// -consul or the configuration file. If no backend is selected nil is
+// returned and Mongo is addressed directly with -mongo.
+func (m *Meta) Discovery() (discovery.Discovery, error) {
+	if m.ForceDiscovery != nil {
+		return m.ForceDiscovery, nil
+	}
+
+	config, err := m.Config()
+	if err != nil {
+		return nil, err
+	}
+
+	name := m.discoveryName
 	if m.consul {
-		nodes, err := m.consulAgent.GetService(
-			m.consulKey,
-			"",
-		)
+		name = "consul"
+	}
+	if name == "" {
+		name = config.Discovery
+	}
+
+	switch name {
+	case "", "none":
+		return nil, nil
+	case "consul":
+		if m.consulAgent == nil {
+			m.consulAgent = m.newConsulAgent(config)
+		}
+		return m.consulAgent, nil
+	case "dns":
+		resolver := &dns.Resolver{
+			Domain: m.dnsDomain,
+			Server: m.dnsServer,
+		}
+		if resolver.Domain == "" {
+			resolver.Domain = config.DNSDomain
+		}
+		if resolver.Server == "" {
+			resolver.Server = config.DNSServer
+		}
+		return resolver, nil
+	case "etcd":
+		agent := &etcd.Agent{
+			Prefix: m.etcdPrefix,
+			TTL:    m.etcdTTL,
+		}
+		endpoints := m.etcdEndpoints
+		if endpoints == "" {
+			endpoints = config.EtcdEndpoints
+		}
+		if endpoints != "" {
+			agent.Endpoints = strings.Split(endpoints, ",")
+		}
+		if agent.Prefix == "" {
+			agent.Prefix = config.EtcdPrefix
+		}
+		if agent.TTL == 0 {
+			agent.TTL = config.EtcdTTL
+		}
+		return agent, nil
+	case "inventory":
+		path := m.inventory
+		if path == "" {
+			path = config.Inventory
+		}
+		if path == "" {
+			return nil, fmt.Errorf("No inventory file configured")
+		}
+		return &inventory.File{Path: path}, nil
+	default:
+		return nil, fmt.Errorf("Unknown discovery backend: %s", name)
+	}
+}
+
+// newConsulAgent builds the Consul agent from the -consul-* flags. A
+// setting not given as a flag is left to the Consul client if its
+// environment variable is set, which the client reads, and otherwise
+// falls back to the configuration file.
+func (m *Meta) newConsulAgent(config *Config) *consul.Agent {
+	agent := m.consulConfig
+	fallback := func(value *string, def string, env ...string) {
+		for _, name := range env {
+			if os.Getenv(name) != "" {
+				return
+			}
+		}
+		if *value == "" {
+			*value = def
+		}
+	}
+	fallback(&agent.Server, config.ConsulServer, api.HTTPAddrEnvName)
+	fallback(&agent.Scheme, config.ConsulScheme, api.HTTPSSLEnvName)
+	fallback(&agent.Datacenter, config.ConsulDatacenter)
+	fallback(&agent.Token, config.ConsulToken, api.HTTPTokenEnvName, api.HTTPTokenFileEnvName)
+	fallback(&agent.CAFile, config.ConsulCAFile, api.HTTPCAFile)
+	fallback(&agent.CertFile, config.ConsulCertFile, api.HTTPClientCert)
+	fallback(&agent.KeyFile, config.ConsulKeyFile, api.HTTPClientKey)
+	fallback(&agent.Check.Type, config.ConsulCheck)
+	fallback(&agent.Check.Interval, config.ConsulCheckInterval)
+	fallback(&agent.Check.Timeout, config.ConsulCheckTimeout)
+	fallback(&agent.Check.TTL, config.ConsulCheckTTL)
+	fallback(&agent.Check.HTTP, config.ConsulCheckHTTP)
+	fallback(&agent.Check.DeregisterCriticalAfter, config.ConsulCheckDeregisterCritical)
+	return &agent
+}
+
+// GetNode returns the address of a Mongo server to connect to, either
+// the first registered service from the discovery backend or -mongo.
+func (m *Meta) GetNode() (node string, err error) {
+	d, err := m.Discovery()
+	if err != nil {
+		return "", err
+	}
+	if d == nil {
+		return m.mongoServer, nil
+	}
+
+	services, err := d.Lookup(m.serviceName)
+	if err != nil {
+		return "", err
+	}
+	if len(services) == 0 {
+		return "", fmt.Errorf("No nodes found for service %s", m.serviceName)
+	}
+	return services[0].String(), nil
+}
+
+// Client returns a replica set client connected to the node returned
+// by GetNode. If username is set the password is read from the Ui. The
+// direct flag should be set when talking to a node that is not yet part
+// of a replica set.
+func (m *Meta) Client(username string, direct bool) (replset.Client, error) {
+	if m.ForceClient != nil {
+		return m.wrapClient(m.ForceClient), nil
+	}
+
+	node, err := m.GetNode()
+	if err != nil {
+		return nil, err
+	}
+	return m.dial(node, username, direct)
+}
+
+// dial returns a replica set client connected to the given node.
+func (m *Meta) dial(node, username string, direct bool) (replset.Client, error) {
+	if m.ForceClient != nil {
+		return m.wrapClient(m.ForceClient), nil
+	}
+
+	info := &mgo.DialInfo{
+		Addrs:    []string{node},
+		Timeout:  5 * time.Second,
+		Username: username,
+		Direct:   direct,
+	}
+
+	// Backends such as DNS publish the replica set name and auth
+	// source along with the members.
+	d, err := m.Discovery()
+	if err != nil {
+		return nil, err
+	}
+	if o, ok := d.(discovery.Optioner); ok {
+		options, err := o.Options(m.serviceName)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		service := nodes[0]
-		return fmt.Sprintf("%s:%d", service.Address, service.ServicePort), nil
+		info.ReplicaSetName = options.Get("replicaSet")
+		info.Source = options.Get("authSource")
 	}
-	return m.mongoServer, nil
+
+	if len(username) > 0 {
+		if m.password == "" {
+			m.password, _ = m.Ui.Ask("Password: ")
+		}
+		info.Password = m.password
+	}
+	session, err := replset.Dial(info)
+	if err != nil {
+		return nil, err
+	}
+	return m.wrapClient(session), nil
+}
+
+// wrapClient wraps client so that changes are only printed when
+// -dry-run is set.
+func (m *Meta) wrapClient(client replset.Client) replset.Client {
+	if !m.dryRun {
+		return client
+	}
+	return &replset.DryRun{
+		Client: client,
+		Output: m.Ui.Output,
+	}
+}
+
+// describe sets the tags of service to the roles of the member in the
+// set and records the name of the set in its meta.
+func (m *Meta) describe(service *discovery.Service, config *commgo.RsConf, status *commgo.RsStatus) {
+	m.describeAs(service, service.String(), config, status)
+}
+
+// describeAs is describe for a service whose member is configured in
+// the set as host, such as a newly initiated member which the set knows
+// by its hostname.
+func (m *Meta) describeAs(service *discovery.Service, host string, config *commgo.RsConf, status *commgo.RsStatus) {
+	var member *commgo.Host
+	if i := replset.FindMember(config, host); i >= 0 {
+		member = config.Members[i]
+	}
+	service.Tags = replset.Roles(member, replset.FindStats(status, host))
+	service.Meta = map[string]string{
+		"replica_set": config.ID,
+	}
+}
+
+// register adds service to the discovery backend, or prints what would
+// be registered when -dry-run is set. Read only backends are skipped, in
+// which case false is returned so that the registration isn't reported.
+func (m *Meta) register(d discovery.Discovery, service *discovery.Service) (bool, error) {
+	if m.dryRun {
+		var tags string
+		if len(service.Tags) > 0 {
+			tags = fmt.Sprintf(" tagged %s", strings.Join(service.Tags, ","))
+		}
+		m.Ui.Output(fmt.Sprintf("Would register %s as %s with id %s%s",
+			service, m.serviceName, service.ID, tags))
+		return true, nil
+	}
+	err := d.Register(m.serviceName, service)
+	if err == discovery.ErrReadOnly {
+		m.Ui.Info("Discovery backend is read only, skipping registration")
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// deregister removes service from the discovery backend, or prints what
+// would be removed when -dry-run is set. Read only backends are skipped,
+// in which case false is returned so that the removal isn't reported.
+func (m *Meta) deregister(d discovery.Discovery, service *discovery.Service) (bool, error) {
+	if m.dryRun {
+		m.Ui.Output(fmt.Sprintf("Would deregister %s from %s with id %s",
+			service, m.serviceName, service.ID))
+		return true, nil
+	}
+	err := d.Deregister(m.serviceName, service)
+	if err == discovery.ErrReadOnly {
+		m.Ui.Info("Discovery backend is read only, skipping deregistration")
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// checkRemove reports the quorum analysis for removing hosts from the
+// set and returns whether the removal may go ahead. Unsafe removals are
+// refused unless force is set.
+func (m *Meta) checkRemove(config *commgo.RsConf, status *commgo.RsStatus, force bool, hosts ...string) bool {
+	m.Ui.Info(fmt.Sprintf("Before: %s", replset.NewQuorum(config, status)))
+	quorum, err := replset.CheckRemove(config, status, hosts...)
+	if quorum != nil {
+		m.Ui.Info(fmt.Sprintf("After:  %s", quorum))
+	}
+	if err == nil {
+		return true
+	}
+	if force {
+		m.Ui.Error(fmt.Sprintf("Warning: %s, continuing because of -force", err.Error()))
+		return true
+	}
+	m.Ui.Error(fmt.Sprintf("Error: %s, use -force to remove anyway", err.Error()))
+	return false
+}
+
+// confirm asks the user to confirm a change, returning true only if
+// they answer yes.
+func (m *Meta) confirm(question string) (bool, error) {
+	answer, err := m.Ui.Ask(fmt.Sprintf("\n%s Only 'yes' will be accepted:", question))
+	if err != nil {
+		return false, err
+	}
+	return answer == "yes", nil
 }
 
 func (m *Meta) GetLocalIP() (ip string, err error) {
@@ -127,3 +457,101 @@ func (m *Meta) GetLocalIP() (ip string, err error) {
 	}
 	return addr, nil
 }
+
+// generalOptionsUsage returns the usage documentation for the flags
+// added by FlagSetServer, shared by every command.
+func generalOptionsUsage() string {
+	general := `
+  -mongo=addr             The address of the Mongo server if not using
+                          a discovery backend.
+
+  -service=service        The service name to use when looking up Mongo
+                          with a discovery backend. Defaults to mongodb.
+  -consul-service=service Alias of -service.
+
+  -discovery=backend      The discovery backend used to find Mongo,
+                          one of consul, dns, etcd or inventory.
+
+  -consul                 Use consul to find Mongo, the same as
+                          -discovery=consul.
+
+  -consul-server=addr     The address of the consul server to use,
+                          this defaults to 127.0.0.1:8500.
+
+  -consul-scheme=scheme   The scheme used to talk to consul, http or https.
+
+  -consul-datacenter=dc   The consul datacenter to use.
+
+  -consul-token=token     The ACL token used with consul.
+
+  -consul-ca-file=path    The CA certificate used to verify consul.
+
+  -consul-cert-file=path  The client certificate and key used to
+  -consul-key-file=path   authenticate with consul.
+
+                          Any consul setting not given falls back to the
+                          CONSUL_HTTP_* variables and then the config file.
+
+  -consul-check=type      The health check registered with each member,
+                          one of tcp, http, ttl, script or none.
+                          Defaults to tcp. A ttl check is passed by
+                          mongoctl agent while it runs, and script runs
+                          /bin/nc as older versions did.
+
+  -consul-check-interval=duration
+                          How often tcp, http and script checks run.
+                          Defaults to 15s.
+
+  -consul-check-timeout=duration
+                          The timeout of tcp, http and script checks.
+
+  -consul-check-ttl=duration
+                          How long a ttl check passes without an update.
+                          Defaults to 30s.
+
+  -consul-check-http=url  The URL polled by http checks, such as the
+                          health endpoint served by mongoctl agent -http.
+
+  -consul-check-deregister=duration
+                          Remove a member from consul once its check has
+                          been critical for this long.
+
+  -dns-domain=domain      The domain to resolve _mongodb._tcp SRV records
+                          under when using dns discovery.
+
+  -dns-server=addr        The DNS server to query, defaults to the
+                          system resolver.
+
+  -etcd-endpoints=addrs   Comma separated etcd endpoints when using etcd
+                          discovery, defaults to 127.0.0.1:2379.
+
+  -etcd-prefix=prefix     The key prefix registrations are stored under,
+                          defaults to /mongoctl/services.
+
+  -etcd-ttl=seconds       If set, registrations are attached to a lease
+                          with this TTL.
+
+  -inventory=path         The inventory file to read clusters from when
+                          using inventory discovery.
+
+  -format=format          The output format of the result, one of table,
+                          json, yaml or template. Defaults to table.
+                          With json and yaml progress messages are
+                          written to stderr.
+
+  -template=template      A Go text/template executed with the result,
+                          implies -format=template.
+`
+	return strings.TrimSpace(general)
+}
+
+// dryRunOptionsUsage returns the usage documentation for -dry-run, for
+// the commands created with FlagSetDryRun.
+func dryRunOptionsUsage() string {
+	dryRun := `
+  -dry-run                Read the current state and print the commands
+                          and registrations that would be made without
+                          making them.
+`
+	return strings.TrimSpace(dryRun)
+}
@@ -0,0 +1,360 @@
+package command
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aocsolutions/mongoctl/replset"
+	"github.com/aocsolutions/mongoctl/spec"
+	"github.com/nevins-b/commgo"
+)
+
+// The types below are the results of commands as written by -format.
+// Their json and yaml field names are the stable schema relied on by
+// scripts, so only add to them.
+
+// statusOutput is the result of status.
+type statusOutput struct {
+	Set     string         `json:"set" yaml:"set"`
+	Date    time.Time      `json:"date" yaml:"date"`
+	Members []memberOutput `json:"members" yaml:"members"`
+	Oplog   *oplogOutput   `json:"oplog" yaml:"oplog"`
+}
+
+// memberOutput is the status of one member of the set. Health is
+// whether the member answers heartbeats, as reported by
+// replSetGetStatus, and Usable whether it is PRIMARY, SECONDARY or
+// ARBITER, so a member in initial sync is healthy but not usable.
+type memberOutput struct {
+	Name          string     `json:"name" yaml:"name"`
+	State         string     `json:"state" yaml:"state"`
+	StateCode     int        `json:"state_code" yaml:"state_code"`
+	Health        bool       `json:"health" yaml:"health"`
+	Usable        bool       `json:"usable" yaml:"usable"`
+	Optime        time.Time  `json:"optime" yaml:"optime"`
+	LagSeconds    float64    `json:"lag_seconds" yaml:"lag_seconds"`
+	LagExceeded   bool       `json:"lag_exceeded" yaml:"lag_exceeded"`
+	LastHeartbeat *time.Time `json:"last_heartbeat" yaml:"last_heartbeat"`
+	PingMs        int64      `json:"ping_ms" yaml:"ping_ms"`
+	SyncSource    string     `json:"sync_source" yaml:"sync_source"`
+	Self          bool       `json:"self" yaml:"self"`
+}
+
+// oplogOutput is the oplog window of the primary.
+type oplogOutput struct {
+	First         time.Time `json:"first" yaml:"first"`
+	Last          time.Time `json:"last" yaml:"last"`
+	WindowSeconds float64   `json:"window_seconds" yaml:"window_seconds"`
+	BelowMinimum  bool      `json:"below_minimum" yaml:"below_minimum"`
+
+	minimum time.Duration
+}
+
+// statusThresholds are the limits beyond which status flags the set,
+// a zero value disables the check.
+type statusThresholds struct {
+	maxLag         time.Duration
+	minOplogWindow time.Duration
+}
+
+func newStatusOutput(status *commgo.RsStatus, oplog *replset.OplogWindow, limits statusThresholds) *statusOutput {
+	out := &statusOutput{
+		Set:     status.Set,
+		Date:    status.Date,
+		Members: make([]memberOutput, 0, len(status.Members)),
+	}
+	for _, member := range status.Members {
+		lag := replset.Lag(status, member)
+		out.Members = append(out.Members, memberOutput{
+			Name:          member.Name,
+			State:         member.StateStr,
+			StateCode:     member.State,
+			Health:        member.Health == 1,
+			Usable:        replset.Healthy(member),
+			Optime:        member.OptimeDate,
+			LagSeconds:    lag.Seconds(),
+			LagExceeded:   limits.maxLag > 0 && lag > limits.maxLag,
+			LastHeartbeat: member.LastHeartbeat,
+			PingMs:        member.PingMs,
+			SyncSource:    member.SyncingTo,
+			Self:          member.Self,
+		})
+	}
+	if oplog != nil {
+		out.Oplog = &oplogOutput{
+			First:         oplog.First,
+			Last:          oplog.Last,
+			WindowSeconds: oplog.Duration().Seconds(),
+			BelowMinimum:  limits.minOplogWindow > 0 && oplog.Duration() < limits.minOplogWindow,
+			minimum:       limits.minOplogWindow,
+		}
+	}
+	return out
+}
+
+func (s *statusOutput) Table() string {
+	rows := [][]string{{"Node", "State", "Health", "Lag", "Ping", "Sync Source", "Last Heartbeat"}}
+	for _, member := range s.Members {
+		health := "ok"
+		if !member.Health {
+			health = "down"
+		}
+		lag := (time.Duration(member.LagSeconds) * time.Second).String()
+		if member.LagExceeded {
+			lag += " !"
+		}
+		var heartbeat string
+		if member.LastHeartbeat != nil {
+			heartbeat = member.LastHeartbeat.Format(time.RFC3339)
+		}
+		rows = append(rows, []string{
+			member.Name,
+			member.State,
+			health,
+			lag,
+			fmt.Sprintf("%dms", member.PingMs),
+			member.SyncSource,
+			heartbeat,
+		})
+	}
+
+	table := formatTable(rows)
+	if s.Oplog != nil {
+		table += "\n" + s.Oplog.String() + "\n"
+	}
+	return table
+}
+
+func (o *oplogOutput) String() string {
+	window := time.Duration(o.WindowSeconds) * time.Second
+	out := fmt.Sprintf("Oplog window: %s (%s to %s)", window,
+		o.First.Format(time.RFC3339), o.Last.Format(time.RFC3339))
+	if o.BelowMinimum {
+		out += fmt.Sprintf(" ! below the minimum of %s", o.minimum)
+	}
+	return out
+}
+
+// statusEvent is a change in the status of the set seen by watching.
+type statusEvent struct {
+	Time   time.Time `json:"time" yaml:"time"`
+	Member string    `json:"member" yaml:"member"`
+	Event  string    `json:"event" yaml:"event"`
+	From   string    `json:"from" yaml:"from"`
+	To     string    `json:"to" yaml:"to"`
+}
+
+func (e *statusEvent) Table() string {
+	from, to := e.From, e.To
+	if len(from) == 0 {
+		from = "none"
+	}
+	if len(to) == 0 {
+		to = "none"
+	}
+	return fmt.Sprintf("%s %s %s: %s -> %s",
+		e.Time.Format(time.RFC3339), e.Member, e.Event, from, to)
+}
+
+// initOutput is the result of init.
+type initOutput struct {
+	Host       string                 `json:"host" yaml:"host"`
+	Registered []string               `json:"registered" yaml:"registered"`
+	DryRun     bool                   `json:"dry_run" yaml:"dry_run"`
+	Result     map[string]interface{} `json:"result" yaml:"result"`
+}
+
+func (i *initOutput) Table() string {
+	keys := make([]string, 0, len(i.Result))
+	for k := range i.Result {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	rows := [][]string{{"Key", "Value"}}
+	for _, k := range keys {
+		rows = append(rows, []string{k, fmt.Sprintf("%v", i.Result[k])})
+	}
+	return formatTable(rows)
+}
+
+// changeOutput is the result of a command which changes the members
+// of the set or their registrations.
+type changeOutput struct {
+	Set          string   `json:"set" yaml:"set"`
+	Version      int      `json:"version" yaml:"version"`
+	Added        []string `json:"added" yaml:"added"`
+	Removed      []string `json:"removed" yaml:"removed"`
+	Changed      []string `json:"changed" yaml:"changed"`
+	Registered   []string `json:"registered" yaml:"registered"`
+	Deregistered []string `json:"deregistered" yaml:"deregistered"`
+	DryRun       bool     `json:"dry_run" yaml:"dry_run"`
+}
+
+func newChangeOutput(config *commgo.RsConf, dryRun bool) *changeOutput {
+	out := &changeOutput{
+		Added:        []string{},
+		Removed:      []string{},
+		Changed:      []string{},
+		Registered:   []string{},
+		Deregistered: []string{},
+		DryRun:       dryRun,
+	}
+	if config != nil {
+		out.Set = config.ID
+		out.Version = config.Version
+	}
+	return out
+}
+
+// Table is empty as the commands report their changes as they go.
+func (c *changeOutput) Table() string {
+	return ""
+}
+
+// cleanOutput is the result of clean.
+type cleanOutput struct {
+	changeOutput `yaml:",inline"`
+	Pending      []pendingRemoval `json:"pending" yaml:"pending"`
+}
+
+// pendingRemoval is a dead member which clean will remove once it has
+// been down for the grace period.
+type pendingRemoval struct {
+	Host      string    `json:"host" yaml:"host"`
+	DownSince time.Time `json:"down_since" yaml:"down_since"`
+	RemoveAt  time.Time `json:"remove_at" yaml:"remove_at"`
+}
+
+// planOutput is the result of plan and apply.
+type planOutput struct {
+	Changes []changeEntry `json:"changes" yaml:"changes"`
+	Steps   []string      `json:"steps" yaml:"steps"`
+	Applied bool          `json:"applied" yaml:"applied"`
+
+	plan *spec.Plan
+}
+
+// changeEntry is one member or setting change of a plan.
+type changeEntry struct {
+	Action string   `json:"action" yaml:"action"`
+	Host   string   `json:"host" yaml:"host"`
+	Fields []string `json:"fields" yaml:"fields"`
+}
+
+func newPlanOutput(plan *spec.Plan) *planOutput {
+	out := &planOutput{
+		Changes: []changeEntry{},
+		Steps:   []string{},
+		plan:    plan,
+	}
+	for _, change := range plan.Changes {
+		fields := change.Fields
+		if fields == nil {
+			fields = []string{}
+		}
+		out.Changes = append(out.Changes, changeEntry{
+			Action: change.Action,
+			Host:   change.Host,
+			Fields: fields,
+		})
+	}
+	for _, step := range plan.Steps {
+		out.Steps = append(out.Steps, step.Description)
+	}
+	return out
+}
+
+func (p *planOutput) Table() string {
+	if p.Applied {
+		return ""
+	}
+	if p.plan.Empty() {
+		return "No changes, the replica set matches the spec."
+	}
+
+	lines := []string{
+		"Changes:",
+		strings.TrimRight(p.plan.String(), "\n"),
+		"",
+		"Steps:",
+	}
+	for i, step := range p.Steps {
+		lines = append(lines, fmt.Sprintf("  %d. %s", i+1, step))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// primaryOutput is the result of stepdown and elect.
+type primaryOutput struct {
+	Previous string `json:"previous" yaml:"previous"`
+	Primary  string `json:"primary" yaml:"primary"`
+}
+
+func (p *primaryOutput) Table() string {
+	if p.Previous == p.Primary {
+		return fmt.Sprintf("%s is already primary", p.Primary)
+	}
+	return fmt.Sprintf("New primary is %s", p.Primary)
+}
+
+// freezeOutput is the result of freeze.
+type freezeOutput struct {
+	Hosts   []string `json:"hosts" yaml:"hosts"`
+	Seconds int      `json:"seconds" yaml:"seconds"`
+}
+
+// Table is empty as freeze reports each host as it goes.
+func (f *freezeOutput) Table() string {
+	return ""
+}
+
+// rollingOutput is the result of rolling.
+type rollingOutput struct {
+	Members []string `json:"members" yaml:"members"`
+}
+
+// Table is empty as rolling reports each member as it goes.
+func (r *rollingOutput) Table() string {
+	return ""
+}
+
+// syncOutput is the result of sync.
+type syncOutput struct {
+	Set     string      `json:"set" yaml:"set"`
+	Version int         `json:"version" yaml:"version"`
+	Drift   []syncEntry `json:"drift" yaml:"drift"`
+	DryRun  bool        `json:"dry_run" yaml:"dry_run"`
+}
+
+// syncEntry is one drifted member or registration and what sync did
+// about it, an empty action when its policy flag wasn't given.
+type syncEntry struct {
+	Host   string `json:"host" yaml:"host"`
+	Drift  string `json:"drift" yaml:"drift"`
+	Action string `json:"action" yaml:"action"`
+}
+
+func (s *syncOutput) add(host, drift string) *syncEntry {
+	s.Drift = append(s.Drift, syncEntry{Host: host, Drift: drift})
+	return &s.Drift[len(s.Drift)-1]
+}
+
+func (s *syncOutput) Table() string {
+	if len(s.Drift) == 0 {
+		return "Discovery and the replica set are in sync"
+	}
+	rows := [][]string{{"Host", "Drift", "Action"}}
+	for _, entry := range s.Drift {
+		action := entry.Action
+		if len(action) == 0 {
+			action = "none"
+		} else if s.DryRun {
+			action = "would " + action
+		}
+		rows = append(rows, []string{entry.Host, entry.Drift, action})
+	}
+	return formatTable(rows)
+}
@@ -0,0 +1,95 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aocsolutions/mongoctl/spec"
+)
+
+type PlanCommand struct {
+	Meta
+}
+
+func (c *PlanCommand) Run(args []string) int {
+	var file, username string
+	flags := c.Meta.FlagSet("plan", FlagSetDefault)
+	flags.Usage = func() { c.Ui.Error(c.Help()) }
+	flags.StringVar(&file, "f", "", "")
+	flags.StringVar(&username, "username", "", "")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	plan, code := c.Meta.plan(file, username)
+	if plan == nil {
+		return code
+	}
+	return c.Meta.output(newPlanOutput(plan))
+}
+
+// plan loads the spec at file and diffs it against the live replica
+// set. On failure the error has been reported and the exit code is
+// returned.
+func (m *Meta) plan(file, username string) (*spec.Plan, int) {
+	if len(file) == 0 {
+		m.Ui.Error("Error: a spec file must be given with -f")
+		return nil, 1
+	}
+
+	s, err := spec.LoadSpec(file)
+	if err != nil {
+		m.Ui.Error(fmt.Sprintf("Error loading spec: %s", err.Error()))
+		return nil, 1
+	}
+
+	client, err := m.Client(username, false)
+	if err != nil {
+		m.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return nil, 1
+	}
+	defer client.Close()
+
+	config, err := client.GetConfig()
+	if err != nil {
+		m.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return nil, 1
+	}
+
+	plan, err := spec.Diff(config, s)
+	if err != nil {
+		m.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return nil, 1
+	}
+	return plan, 0
+}
+
+// outputPlan prints the changes and steps of a plan.
+func (m *Meta) outputPlan(plan *spec.Plan) {
+	m.Ui.Output(newPlanOutput(plan).Table())
+}
+
+func (c *PlanCommand) Help() string {
+	helpText := `
+Usage: mongoctl plan -f cluster.hcl [options]
+  Show the changes needed to make a Replica Set match a spec.
+  This command connects to a Mongo server, compares the replica set
+  configuration with the members and settings described in the spec
+  file, and prints the changes and the sequence of reconfigs that
+  apply would run. Nothing is changed.
+
+General Options:
+  ` + generalOptionsUsage() + `
+
+Plan Options:
+
+  -f=path                 The spec file describing the replica set.
+
+  -username=username      The username to authenticate with if required.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *PlanCommand) Synopsis() string {
+	return "Show changes needed to match a replica set spec"
+}
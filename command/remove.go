@@ -6,11 +6,9 @@ import (
 	"net"
 	"net/http"
 	"strings"
-	"time"
 
-	"github.com/nevins-b/commgo"
-	"gopkg.in/mgo.v2"
-	"gopkg.in/mgo.v2/bson"
+	"github.com/aocsolutions/mongoctl/discovery"
+	"github.com/aocsolutions/mongoctl/replset"
 )
 
 type RemoveCommand struct {
@@ -19,14 +17,15 @@ type RemoveCommand struct {
 
 func (c *RemoveCommand) Run(args []string) int {
 	var port int
-	var ec2 bool
+	var ec2, force bool
 	var addr, username string
-	flags := c.Meta.FlagSet("add", FlagSetDefault)
+	flags := c.Meta.FlagSet("remove", FlagSetDefault|FlagSetDryRun)
 	flags.Usage = func() { c.Ui.Error(c.Help()) }
 	flags.IntVar(&port, "port", 27017, "")
 	flags.StringVar(&addr, "addr", "", "")
 	flags.StringVar(&username, "username", "", "")
 	flags.BoolVar(&ec2, "ec2", false, "")
+	flags.BoolVar(&force, "force", false, "")
 	if err := flags.Parse(args); err != nil {
 		return 1
 	}
@@ -60,79 +59,66 @@ func (c *RemoveCommand) Run(args []string) int {
 	}
 
 	c.Ui.Info(fmt.Sprintf("Removing %s:%d from Cluster %s", addr, port, node))
-	info := &mgo.DialInfo{
-		Addrs:    []string{node},
-		Timeout:  5 * time.Second,
-		Username: username,
-	}
-
-	if len(username) > 0 {
-		info.Password, _ = c.Ui.Ask("Password: ")
-	}
-	session, err := mgo.DialWithInfo(info)
+	client, err := c.Meta.Client(username, false)
 	if err != nil {
 		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
 		return 1
 	}
+	defer client.Close()
 
-	defer session.Close()
-
-	config := &commgo.RsConf{}
-	conn := session.DB("local").C("system.replset")
-	count, err := conn.Count()
-	if count > 1 {
-		c.Ui.Error("Error: local.system.replset has unexpected contents")
-		return 1
-	}
-	err = conn.Find(bson.M{}).One(&config)
+	config, err := client.GetConfig()
 	if err != nil {
 		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
 		return 1
 	}
-	config.Version++
 
 	host := fmt.Sprintf("%s:%d", addr, port)
-	found := false
-	for i, member := range config.Members {
-		if member.Host == host {
-			config.Members = append(config.Members[:i], config.Members[i+1:]...)
-			found = true
-			break
+	out := newChangeOutput(config, c.Meta.dryRun)
+	if replset.FindMember(config, host) >= 0 {
+		status, err := client.Status()
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+			return 1
 		}
-	}
-
-	if found {
-		cmd := &bson.M{
-			"replSetReconfig": config,
+		if !c.Meta.checkRemove(config, status, force, host) {
+			return 1
 		}
-		result := bson.M{}
-		if err := session.DB("admin").Run(&cmd, &result); err != nil {
+
+		replset.RemoveMember(config, host)
+		if err := client.Reconfig(config); err != nil {
 			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
 			return 1
 		}
+		out.Version = config.Version
+		out.Removed = append(out.Removed, host)
 	} else {
 		c.Ui.Error(fmt.Sprintf("Node %s not found in cluster", host))
 	}
 
-	if c.Meta.consul {
-		nodes, err := c.Meta.consulAgent.GetService(c.Meta.consulKey, "")
+	d, err := c.Meta.Discovery()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+	if d != nil {
+		registered, err := d.Lookup(c.Meta.serviceName)
 		if err != nil {
 			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
 			return 1
 		}
 
-		for _, node := range nodes {
-			if node.Address == addr && node.ServicePort == port {
-				err = c.Meta.consulAgent.RemoveService(node)
-				if err != nil {
-					c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
-					return 1
-				}
-				break
+		if service := discovery.Find(registered, addr, port); service != nil {
+			ok, err := c.Meta.deregister(d, service)
+			if err != nil {
+				c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+				return 1
+			}
+			if ok {
+				out.Deregistered = append(out.Deregistered, service.ID)
 			}
 		}
 	}
-	return 0
+	return c.Meta.output(out)
 }
 
 func (c *RemoveCommand) Help() string {
@@ -144,32 +130,30 @@ Usage: mongoctl remove [options]
   the node from the Mongo service in consul.
 
 General Options:
-  -mongo=addr             The address of the Mongo server if not using Consul.
-
-  -consul-service=service The service name to use when looking up Mongo
-                          with consul.
-
-  -consul-server=addr     The address of the consul server to use,
-                          this defaults to 127.0.0.1:8500.
-  -consul                 Use consul to find Mongo
+  ` + generalOptionsUsage() + `
 
-Init Options:
+Remove Options:
 
   -username=username      The username to authenticate with if required.
 
-  -addr=addr              The address of the host to add.
+  -addr=addr              The address of the host to remove.
 
-  -port=port              The port of the host to add.
+  -port=port              The port of the host to remove.
                           Defaults to 27017.
 
-  -ec2                    If the host to be added is an EC2 instance.
+  -force                  Remove the host even if it is the primary or the
+                          set would be left without a voting majority.
+
+  -ec2                    If the host to be removed is an EC2 instance.
                           This can be used to discover the address of the
-                          instance to add, assuming the command is run on the
-													instance that is being added.
+                          instance to remove, assuming the command is run on
+                          the instance that is being removed.
+
+  ` + dryRunOptionsUsage() + `
 `
 	return strings.TrimSpace(helpText)
 }
 
 func (c *RemoveCommand) Synopsis() string {
-	return "Add a node to an existing mongo cluster"
+	return "Remove a node from a mongo cluster"
 }
@@ -0,0 +1,119 @@
+package command
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/aocsolutions/mongoctl/replset"
+)
+
+func TestRemoveCommand(t *testing.T) {
+	client, d := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+		testMember{"10.0.0.3:27017", replset.StateSecondary, 1},
+	)
+	meta, ui := testMeta(client, d)
+	c := &RemoveCommand{Meta: meta}
+
+	if code := c.Run([]string{"-addr", "10.0.0.3"}); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+
+	expected := []string{"10.0.0.1:27017", "10.0.0.2:27017"}
+	if actual := hosts(client.Config); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected members %v, got %v", expected, actual)
+	}
+	if actual := d.ids("mongodb"); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected registrations %v, got %v", expected, actual)
+	}
+}
+
+func TestRemoveCommand_unsafe(t *testing.T) {
+	cases := []struct {
+		name    string
+		members []testMember
+		addr    string
+	}{
+		{
+			name: "primary",
+			members: []testMember{
+				{"10.0.0.1:27017", replset.StatePrimary, 1},
+				{"10.0.0.2:27017", replset.StateSecondary, 1},
+				{"10.0.0.3:27017", replset.StateSecondary, 1},
+			},
+			addr: "10.0.0.1",
+		},
+		{
+			name: "majority loss",
+			members: []testMember{
+				{"10.0.0.1:27017", replset.StatePrimary, 1},
+				{"10.0.0.2:27017", replset.StateSecondary, 1},
+				{"10.0.0.3:27017", replset.StateDown, 1},
+				{"10.0.0.4:27017", replset.StateDown, 1},
+			},
+			addr: "10.0.0.2",
+		},
+	}
+
+	for _, tc := range cases {
+		client, d := testSet(tc.members...)
+		meta, _ := testMeta(client, d)
+		c := &RemoveCommand{Meta: meta}
+
+		if code := c.Run([]string{"-addr", tc.addr}); code != 1 {
+			t.Errorf("%s: expected failure, got %d", tc.name, code)
+		}
+		if len(client.Reconfigs) != 0 {
+			t.Errorf("%s: expected no reconfig", tc.name)
+		}
+		if ids := d.ids("mongodb"); len(ids) != len(tc.members) {
+			t.Errorf("%s: expected no deregistration, got %v", tc.name, ids)
+		}
+	}
+}
+
+func TestRemoveCommand_force(t *testing.T) {
+	client, d := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+		testMember{"10.0.0.3:27017", replset.StateDown, 1},
+		testMember{"10.0.0.4:27017", replset.StateDown, 1},
+	)
+	meta, ui := testMeta(client, d)
+	c := &RemoveCommand{Meta: meta}
+
+	if code := c.Run([]string{"-addr", "10.0.0.2", "-force"}); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+	if len(client.Reconfigs) != 1 {
+		t.Fatalf("expected one reconfig, got %d", len(client.Reconfigs))
+	}
+}
+
+func TestRemoveCommand_readOnly(t *testing.T) {
+	client, d := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+		testMember{"10.0.0.3:27017", replset.StateSecondary, 1},
+	)
+	d.ReadOnly = true
+	meta, ui := testMeta(client, d)
+	c := &RemoveCommand{Meta: meta}
+
+	if code := c.Run([]string{"-addr", "10.0.0.3", "-format", "json"}); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+
+	var out changeOutput
+	if err := json.Unmarshal(ui.OutputWriter.Bytes(), &out); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(out.Removed, []string{"10.0.0.3:27017"}) {
+		t.Fatalf("expected the member to be removed, got %v", out.Removed)
+	}
+	if len(out.Deregistered) != 0 {
+		t.Fatalf("expected no deregistration to be reported, got %v", out.Deregistered)
+	}
+}
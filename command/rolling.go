@@ -0,0 +1,286 @@
+package command
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/aocsolutions/mongoctl/replset"
+	"github.com/nevins-b/commgo"
+)
+
+type RollingCommand struct {
+	Meta
+}
+
+// rollingOptions are the settings of a rolling run.
+type rollingOptions struct {
+	hook     string
+	ssh      bool
+	sshUser  string
+	username string
+	maxLag   time.Duration
+	timeout  time.Duration
+}
+
+func (c *RollingCommand) Run(args []string) int {
+	var opts rollingOptions
+	var arbiters, yes bool
+	flags := c.Meta.FlagSet("rolling", FlagSetDefault)
+	flags.Usage = func() { c.Ui.Error(c.Help()) }
+	flags.StringVar(&opts.username, "username", "", "")
+	flags.StringVar(&opts.hook, "hook", "", "")
+	flags.BoolVar(&opts.ssh, "ssh", false, "")
+	flags.StringVar(&opts.sshUser, "ssh-user", "", "")
+	flags.DurationVar(&opts.maxLag, "max-lag", 10*time.Second, "")
+	flags.DurationVar(&opts.timeout, "timeout", 10*time.Minute, "")
+	flags.BoolVar(&arbiters, "arbiters", false, "")
+	flags.BoolVar(&yes, "yes", false, "")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if len(opts.hook) == 0 {
+		c.Ui.Error("Error: a hook to run on each member must be given with -hook")
+		return 1
+	}
+
+	client, err := c.Meta.Client(opts.username, false)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+	defer client.Close()
+
+	config, err := client.GetConfig()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+	status, err := client.Status()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+
+	primary := replset.Primary(status)
+	if primary == nil {
+		c.Ui.Error("Error: the replica set has no primary")
+		return 1
+	}
+
+	// Secondaries first, the primary last
+	var order []string
+	for _, member := range config.Members {
+		stats := replset.FindStats(status, member.Host)
+		if stats == nil || !replset.Healthy(stats) {
+			c.Ui.Error(fmt.Sprintf("Error: %s is not healthy, refusing to start", member.Host))
+			return 1
+		}
+		if member.ArbiterOnly && !arbiters {
+			continue
+		}
+		if stats.State != replset.StatePrimary {
+			order = append(order, member.Host)
+		}
+	}
+	order = append(order, primary.Name)
+
+	c.Ui.Output("Members will be handled in this order:")
+	for i, host := range order {
+		c.Ui.Output(fmt.Sprintf("  %d. %s", i+1, host))
+	}
+	if !yes {
+		ok, err := c.Meta.confirm("Start the rolling run?")
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+			return 1
+		}
+		if !ok {
+			c.Ui.Info("Rolling run cancelled.")
+			return 1
+		}
+	}
+
+	for i, host := range order {
+		if host == primary.Name {
+			c.Ui.Info(fmt.Sprintf("Stepping down primary %s", host))
+			if err := client.StepDown(int(opts.timeout/time.Second), int(opts.maxLag/time.Second)); err != nil {
+				return c.abort(order[:i], fmt.Errorf("stepping down %s: %s", host, err))
+			}
+			_, err := replset.WaitForPrimaryOf(client, func(m *commgo.RsMemberStats) bool {
+				return m.Name != host
+			}, opts.timeout)
+			if err != nil {
+				return c.abort(order[:i], err)
+			}
+		}
+
+		if err := c.member(client, host, &opts); err != nil {
+			return c.abort(order[:i], err)
+		}
+	}
+
+	c.Ui.Info("Rolling run complete.")
+	return c.Meta.output(&rollingOutput{Members: order})
+}
+
+// member runs the hook against a single member and waits for it to
+// rejoin the set.
+func (c *RollingCommand) member(client replset.Client, host string, opts *rollingOptions) error {
+	config, err := client.GetConfig()
+	if err != nil {
+		return err
+	}
+	status, err := client.Status()
+	if err != nil {
+		return err
+	}
+
+	// Make sure the set can lose this member and still elect a primary
+	quorum := replset.NewQuorum(config, status)
+	if i := replset.FindMember(config, host); i >= 0 && config.Members[i].Votes > 0 {
+		quorum.Healthy--
+	}
+	if !quorum.HasMajority() {
+		return fmt.Errorf("taking down %s would leave %d of %d voters, %d are needed",
+			host, quorum.Healthy, quorum.Voters, quorum.Majority())
+	}
+
+	c.Ui.Info(fmt.Sprintf("Running hook on %s", host))
+	if err := c.runHook(host, opts); err != nil {
+		return fmt.Errorf("hook failed on %s: %s", host, err)
+	}
+
+	c.Ui.Info(fmt.Sprintf("Waiting for %s to rejoin", host))
+	deadline := time.Now().Add(opts.timeout)
+	for {
+		time.Sleep(time.Second)
+
+		status, err := client.Status()
+		if err == nil {
+			if !replset.NewQuorum(config, status).HasMajority() {
+				return fmt.Errorf("the replica set lost its majority while waiting for %s", host)
+			}
+
+			stats := replset.FindStats(status, host)
+			if stats != nil && (stats.State == replset.StateSecondary || stats.State == replset.StateArbiter) {
+				lag := replset.Lag(status, stats)
+				if lag <= opts.maxLag {
+					c.Ui.Info(fmt.Sprintf("%s is %s, %s behind the primary", host, stats.StateStr, lag))
+					return nil
+				}
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s did not rejoin within %s", host, opts.timeout)
+		}
+	}
+}
+
+// runHook runs the hook for host, either locally or over ssh. The
+// member is passed in the MONGOCTL_MEMBER, MONGOCTL_HOST and
+// MONGOCTL_PORT environment variables. ssh doesn't forward the local
+// environment, so over ssh they are exported by the remote command.
+func (c *RollingCommand) runHook(member string, opts *rollingOptions) error {
+	host, port, err := net.SplitHostPort(member)
+	if err != nil {
+		return err
+	}
+	env := []string{
+		fmt.Sprintf("MONGOCTL_MEMBER=%s", member),
+		fmt.Sprintf("MONGOCTL_HOST=%s", host),
+		fmt.Sprintf("MONGOCTL_PORT=%s", port),
+	}
+
+	var cmd *exec.Cmd
+	if opts.ssh {
+		target := host
+		if len(opts.sshUser) > 0 {
+			target = fmt.Sprintf("%s@%s", opts.sshUser, host)
+		}
+		cmd = exec.Command("ssh", target, remoteCommand(env, opts.hook))
+	} else {
+		cmd = exec.Command("/bin/sh", "-c", opts.hook)
+		cmd.Env = append(os.Environ(), env...)
+	}
+
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		c.Ui.Output(strings.TrimRight(string(out), "\n"))
+	}
+	return err
+}
+
+// remoteCommand returns a shell command which exports env, a list of
+// KEY=value pairs, before running hook.
+func remoteCommand(env []string, hook string) string {
+	var exports []string
+	for _, kv := range env {
+		parts := strings.SplitN(kv, "=", 2)
+		exports = append(exports, fmt.Sprintf("%s=%s", parts[0], shellQuote(parts[1])))
+	}
+	return fmt.Sprintf("export %s; %s", strings.Join(exports, " "), hook)
+}
+
+// shellQuote quotes s as a single word for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// abort reports why the run stopped and which members were done.
+func (c *RollingCommand) abort(done []string, err error) int {
+	c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+	c.Ui.Error("Rolling run aborted, no further members will be touched.")
+	if len(done) > 0 {
+		c.Ui.Error(fmt.Sprintf("Completed members: %s", strings.Join(done, ", ")))
+	}
+	return 1
+}
+
+func (c *RollingCommand) Help() string {
+	helpText := `
+Usage: mongoctl rolling -hook=command [options]
+  Run maintenance on every member of a Mongo Replica Set in turn.
+  This command runs the hook against each secondary, waits for it to
+  return to SECONDARY and catch up with the primary, then steps down the
+  primary and handles it last. The run is aborted if a hook fails, a
+  member does not come back, or the set loses its voting majority.
+
+  The member is passed to the hook in the MONGOCTL_MEMBER, MONGOCTL_HOST
+  and MONGOCTL_PORT environment variables.
+
+General Options:
+  ` + generalOptionsUsage() + `
+
+Rolling Options:
+
+  -username=username      The username to authenticate with if required.
+
+  -hook=command           The command to run for each member, with
+                          /bin/sh locally or on the member with -ssh.
+
+  -ssh                    Run the hook on the member over ssh.
+
+  -ssh-user=user          The user to ssh as.
+
+  -max-lag=duration       How far behind the primary a member may be
+                          before moving on. Defaults to 10s.
+
+  -timeout=duration       How long to wait for each member to rejoin.
+                          Defaults to 10m.
+
+  -arbiters               Also run the hook on arbiters.
+
+  -yes                    Start without asking for confirmation.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *RollingCommand) Synopsis() string {
+	return "Run maintenance on each member in turn"
+}
@@ -0,0 +1,122 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aocsolutions/mongoctl/replset"
+)
+
+// testHook returns a hook which records the member it was run against
+// in a temporary file, a function returning the recorded members and
+// one removing the file.
+func testHook(t *testing.T) (string, func() []string, func()) {
+	dir, err := ioutil.TempDir("", "mongoctl")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	path := filepath.Join(dir, "members")
+	hook := fmt.Sprintf("echo $MONGOCTL_MEMBER >> %s", shellQuote(path))
+	members := func() []string {
+		raw, _ := ioutil.ReadFile(path)
+		return strings.Fields(string(raw))
+	}
+	return hook, members, func() { os.RemoveAll(dir) }
+}
+
+func TestRollingCommand(t *testing.T) {
+	client, d := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+		testMember{"10.0.0.3:27017", replset.StateSecondary, 1},
+	)
+	hook, members, cleanup := testHook(t)
+	defer cleanup()
+	meta, ui := testMeta(client, d)
+	c := &RollingCommand{Meta: meta}
+
+	if code := c.Run([]string{"-hook", hook, "-timeout", "5s", "-yes"}); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+
+	expected := []string{"10.0.0.2:27017", "10.0.0.3:27017", "10.0.0.1:27017"}
+	if actual := members(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected the hook to run on %v, got %v", expected, actual)
+	}
+	status, _ := client.Status()
+	if primary := replset.Primary(status); primary == nil || primary.Name == "10.0.0.1:27017" {
+		t.Fatalf("expected the primary to have stepped down, got %v", primary)
+	}
+}
+
+func TestRollingCommand_unhealthy(t *testing.T) {
+	client, d := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+		testMember{"10.0.0.3:27017", replset.StateDown, 1},
+	)
+	hook, members, cleanup := testHook(t)
+	defer cleanup()
+	meta, _ := testMeta(client, d)
+	c := &RollingCommand{Meta: meta}
+
+	if code := c.Run([]string{"-hook", hook, "-yes"}); code != 1 {
+		t.Fatalf("expected failure, got %d", code)
+	}
+	if actual := members(); len(actual) != 0 {
+		t.Fatalf("expected the hook not to run, got %v", actual)
+	}
+}
+
+func TestRollingCommand_hookFails(t *testing.T) {
+	client, d := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+		testMember{"10.0.0.3:27017", replset.StateSecondary, 1},
+	)
+	meta, ui := testMeta(client, d)
+	c := &RollingCommand{Meta: meta}
+
+	if code := c.Run([]string{"-hook", "exit 1", "-yes"}); code != 1 {
+		t.Fatalf("expected failure, got %d", code)
+	}
+	if !strings.Contains(ui.ErrorWriter.String(), "Rolling run aborted") {
+		t.Fatalf("expected the run to be aborted:\n%s", ui.ErrorWriter.String())
+	}
+	status, _ := client.Status()
+	if primary := replset.Primary(status); primary == nil || primary.Name != "10.0.0.1:27017" {
+		t.Fatalf("expected the primary not to step down, got %v", primary)
+	}
+}
+
+func TestRollingCommand_cancelled(t *testing.T) {
+	client, d := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+	)
+	hook, members, cleanup := testHook(t)
+	defer cleanup()
+	meta, ui := testMeta(client, d)
+	ui.InputReader = strings.NewReader("no\n")
+	c := &RollingCommand{Meta: meta}
+
+	if code := c.Run([]string{"-hook", hook}); code != 1 {
+		t.Fatalf("expected the run to be cancelled, got %d", code)
+	}
+	if actual := members(); len(actual) != 0 {
+		t.Fatalf("expected the hook not to run, got %v", actual)
+	}
+}
+
+func TestRemoteCommand(t *testing.T) {
+	env := []string{"MONGOCTL_MEMBER=10.0.0.1:27017", "MONGOCTL_HOST=it's"}
+	expected := `export MONGOCTL_MEMBER='10.0.0.1:27017' MONGOCTL_HOST='it'\''s'; restart`
+	if actual := remoteCommand(env, "restart"); actual != expected {
+		t.Fatalf("expected %q, got %q", expected, actual)
+	}
+}
@@ -0,0 +1,145 @@
+package command
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/aocsolutions/mongoctl/discovery"
+	"github.com/mitchellh/go-homedir"
+)
+
+// DefaultStatePath is the local file state is kept in when the discovery
+// backend can't store it.
+const DefaultStatePath = "~/.mongoctl-state"
+
+// fileStore is a discovery.Storer backed by a local JSON file, keyed by
+// <name>/<key>.
+type fileStore struct {
+	path string
+}
+
+func (f *fileStore) load() (map[string]json.RawMessage, error) {
+	path, err := homedir.Expand(f.path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]json.RawMessage)
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return values, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(contents, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func (f *fileStore) Get(name, key string) ([]byte, error) {
+	values, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	return values[name+"/"+key], nil
+}
+
+func (f *fileStore) Put(name, key string, value []byte) error {
+	values, err := f.load()
+	if err != nil {
+		return err
+	}
+	values[name+"/"+key] = value
+
+	contents, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return err
+	}
+	path, err := homedir.Expand(f.path)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, contents, 0600)
+}
+
+// stateStore returns where state for the cluster is kept: the given
+// file if path is set, otherwise the discovery backend if it can store
+// state, otherwise the state file from the config or DefaultStatePath.
+func (m *Meta) stateStore(d discovery.Discovery, path string) (discovery.Storer, error) {
+	if len(path) > 0 {
+		return &fileStore{path: path}, nil
+	}
+	if s, ok := d.(discovery.Storer); ok {
+		return s, nil
+	}
+
+	config, err := m.Config()
+	if err != nil {
+		return nil, err
+	}
+	if len(config.StateFile) > 0 {
+		return &fileStore{path: config.StateFile}, nil
+	}
+	return &fileStore{path: DefaultStatePath}, nil
+}
+
+// downHistory records when each member was first seen DOWN.
+type downHistory map[string]time.Time
+
+// loadDownHistory reads the history for name from store.
+func loadDownHistory(store discovery.Storer, name string) (downHistory, error) {
+	history := make(downHistory)
+	value, err := store.Get(name, "down")
+	if err != nil || value == nil {
+		return history, err
+	}
+	if err := json.Unmarshal(value, &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// save writes the history for name to store.
+func (h downHistory) save(store discovery.Storer, name string) error {
+	value, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	return store.Put(name, "down", value)
+}
+
+// update records the members in down which are new to the history as
+// down since now, and forgets members which are no longer down.
+func (h downHistory) update(down []string, now time.Time) {
+	seen := make(map[string]bool)
+	for _, host := range down {
+		seen[host] = true
+		if _, ok := h[host]; !ok {
+			h[host] = now
+		}
+	}
+	for host := range h {
+		if !seen[host] {
+			delete(h, host)
+		}
+	}
+}
+
+// expire records the members in down as update does, and splits them
+// into those which have been down for at least grace by now and those
+// still within the grace period.
+func (h downHistory) expire(down []string, grace time.Duration, now time.Time) (expired, pending []string) {
+	h.update(down, now)
+	for _, host := range down {
+		if now.Sub(h[host]) >= grace {
+			expired = append(expired, host)
+		} else {
+			pending = append(pending, host)
+		}
+	}
+	return expired, pending
+}
@@ -0,0 +1,122 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aocsolutions/mongoctl/replset"
+)
+
+func TestDownHistoryUpdate(t *testing.T) {
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	history := make(downHistory)
+
+	steps := []struct {
+		down     []string
+		after    time.Duration
+		expected downHistory
+	}{
+		{
+			down:     []string{"a"},
+			expected: downHistory{"a": start},
+		},
+		{
+			// Still down, the first time it was seen is kept.
+			down:     []string{"a", "b"},
+			after:    time.Minute,
+			expected: downHistory{"a": start, "b": start.Add(time.Minute)},
+		},
+		{
+			// a recovered and is forgotten.
+			down:     []string{"b"},
+			after:    2 * time.Minute,
+			expected: downHistory{"b": start.Add(time.Minute)},
+		},
+		{
+			// a is down again, from now.
+			down:     []string{"a", "b"},
+			after:    3 * time.Minute,
+			expected: downHistory{"a": start.Add(3 * time.Minute), "b": start.Add(time.Minute)},
+		},
+		{
+			down:     nil,
+			after:    4 * time.Minute,
+			expected: downHistory{},
+		},
+	}
+
+	for i, step := range steps {
+		history.update(step.down, start.Add(step.after))
+		if !reflect.DeepEqual(history, step.expected) {
+			t.Fatalf("step %d: expected %v, got %v", i, step.expected, history)
+		}
+	}
+}
+
+func TestCleanExpired(t *testing.T) {
+	client, _ := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateDown, 1},
+		testMember{"10.0.0.3:27017", replset.StateDown, 1},
+	)
+	status, _ := client.Status()
+
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	history := downHistory{"10.0.0.2:27017": now.Add(-10 * time.Minute)}
+
+	meta, _ := testMeta(client, nil)
+	c := &CleanCommand{Meta: meta, now: func() time.Time { return now }}
+	out := &cleanOutput{}
+	expired := c.expired(history, status, 5*time.Minute, out)
+
+	if !reflect.DeepEqual(expired, []string{"10.0.0.2:27017"}) {
+		t.Fatalf("expected only 10.0.0.2:27017 to have expired, got %v", expired)
+	}
+	if len(out.Pending) != 1 {
+		t.Fatalf("expected one pending removal, got %v", out.Pending)
+	}
+	pending := out.Pending[0]
+	if pending.Host != "10.0.0.3:27017" || !pending.DownSince.Equal(now) ||
+		!pending.RemoveAt.Equal(now.Add(5*time.Minute)) {
+		t.Fatalf("bad pending removal: %#v", pending)
+	}
+}
+
+func TestDownHistoryFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mongoctl")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	store := &fileStore{path: filepath.Join(dir, "state")}
+
+	history, err := loadDownHistory(store, "mongodb")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(history) != 0 {
+		t.Fatalf("expected an empty history, got %v", history)
+	}
+
+	since := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	history["a"] = since
+	if err := history.save(store, "mongodb"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	other := downHistory{"b": since}
+	if err := other.save(store, "other"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	loaded, err := loadDownHistory(store, "mongodb")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(loaded) != 1 || !loaded["a"].Equal(since) {
+		t.Fatalf("expected %v, got %v", history, loaded)
+	}
+}
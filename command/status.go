@@ -2,11 +2,13 @@ package command
 
 import (
 	"fmt"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/nevins-b/commgo"
-	"gopkg.in/mgo.v2"
+	"github.com/aocsolutions/mongoctl/replset"
 )
 
 type StatusCommand struct {
@@ -15,54 +17,218 @@ type StatusCommand struct {
 
 func (c *StatusCommand) Run(args []string) int {
 	var username string
-	flags := c.Meta.FlagSet("init", FlagSetDefault)
+	var watch, events bool
+	var interval time.Duration
+	var limits statusThresholds
+	flags := c.Meta.FlagSet("status", FlagSetDefault)
 	flags.Usage = func() { c.Ui.Error(c.Help()) }
 	flags.StringVar(&username, "username", "", "")
+	flags.DurationVar(&limits.maxLag, "max-lag", 10*time.Second, "")
+	flags.DurationVar(&limits.minOplogWindow, "min-oplog-window", 24*time.Hour, "")
+	flags.BoolVar(&watch, "watch", false, "")
+	flags.DurationVar(&interval, "interval", 2*time.Second, "")
+	flags.BoolVar(&events, "events", false, "")
 
 	if err := flags.Parse(args); err != nil {
 		return 1
 	}
 
-	node, err := c.Meta.GetNode()
+	client, err := c.Meta.Client(username, false)
 	if err != nil {
 		c.Ui.Error(err.Error())
 		return 1
 	}
-	info := &mgo.DialInfo{
-		Addrs:    []string{node},
-		Timeout:  5 * time.Second,
-		Username: username,
-	}
+	defer client.Close()
 
-	if len(username) > 0 {
-		info.Password, _ = c.Ui.Ask("Password: ")
+	if watch {
+		return c.watch(client, limits, interval, events)
 	}
-	session, err := mgo.DialWithInfo(info)
+
+	result, err := c.status(client, limits, true)
 	if err != nil {
 		c.Ui.Error(err.Error())
 		return 1
 	}
+	return c.Meta.output(result)
+}
 
-	defer session.Close()
-	result := &commgo.RsStatus{}
+// status reads the status of the set and the oplog window of the
+// primary.
+func (c *StatusCommand) status(client replset.Client, limits statusThresholds, warn bool) (*statusOutput, error) {
+	result, err := client.Status()
+	if err != nil {
+		return nil, err
+	}
 
-	if err := session.DB("admin").Run("replSetGetStatus", result); err != nil {
-		c.Ui.Error(err.Error())
-		return 1
+	// The oplog can't be read from every node, such as arbiters or
+	// without permission on the local database, so only warn.
+	oplog, err := client.OplogWindow()
+	if err != nil && warn {
+		c.Ui.Error(fmt.Sprintf("Warning: unable to read the oplog: %s", err.Error()))
 	}
 
-	c.Ui.Output("Node\t\tState\t\tLast Heartbeat")
-	for _, member := range result.Members {
-		var out string
-		if member.LastHeartbeat != nil {
-			out = fmt.Sprintf("%s\t\t%s\t\t%v", member.Name, member.StateStr, member.LastHeartbeat)
+	return newStatusOutput(result, oplog, limits), nil
+}
+
+// watch polls the status of the set every interval until interrupted.
+// The table is redrawn with changed members highlighted, or with
+// events only the changes are written, one per line.
+func (c *StatusCommand) watch(client replset.Client, limits statusThresholds, interval time.Duration, events bool) int {
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signalCh)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var prev *statusOutput
+	var recent []*statusEvent
+	for first := true; ; first = false {
+		result, err := c.status(client, limits, first)
+		if err != nil {
+			// Polling is expected to fail during elections, so keep
+			// going until the set answers again.
+			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
 		} else {
-			out = fmt.Sprintf("%s\t\t%s", member.Name, member.StateStr)
+			changes := diffStatus(prev, result)
+			switch {
+			case events:
+				for _, event := range changes {
+					if c.Meta.output(event) != 0 {
+						return 1
+					}
+				}
+			case c.Meta.machineFormat():
+				if c.Meta.output(result) != 0 {
+					return 1
+				}
+			default:
+				recent = append(recent, changes...)
+				if len(recent) > watchHistory {
+					recent = recent[len(recent)-watchHistory:]
+				}
+				c.redraw(prev, result, recent, interval)
+			}
+			prev = result
 		}
 
-		c.Ui.Output(out)
+		select {
+		case <-signalCh:
+			return 0
+		case <-ticker.C:
+		}
 	}
-	return 0
+}
+
+// watchHistory is how many recent changes are kept below the table.
+const watchHistory = 10
+
+// redraw clears the terminal and prints the table, highlighting the
+// members whose state changed or whose lag grew since the last poll.
+func (c *StatusCommand) redraw(prev, result *statusOutput, recent []*statusEvent, interval time.Duration) {
+	lines := strings.Split(strings.TrimRight(result.Table(), "\n"), "\n")
+	for i, member := range result.Members {
+		if changed(prev, member) && i+1 < len(lines) {
+			lines[i+1] = "\x1b[1;33m" + lines[i+1] + "\x1b[0m"
+		}
+	}
+
+	c.Ui.Output("\x1b[H\x1b[2J" + fmt.Sprintf("Every %s: mongoctl status  %s\n",
+		interval, time.Now().Format(time.RFC3339)))
+	c.Ui.Output(strings.Join(lines, "\n"))
+	if len(recent) > 0 {
+		c.Ui.Output("\nRecent changes:")
+		for _, event := range recent {
+			c.Ui.Output("  " + event.Table())
+		}
+	}
+}
+
+// changed returns whether member changed state or fell further behind
+// since prev.
+func changed(prev *statusOutput, member memberOutput) bool {
+	if prev == nil {
+		return false
+	}
+	for _, old := range prev.Members {
+		if old.Name == member.Name {
+			return old.State != member.State || member.LagSeconds > old.LagSeconds
+		}
+	}
+	return true
+}
+
+// diffStatus returns the changes between two polls of the status. On
+// the first poll, with no prev, the state of every member is returned.
+func diffStatus(prev, result *statusOutput) []*statusEvent {
+	now := time.Now()
+	var events []*statusEvent
+	old := make(map[string]memberOutput)
+	var oldPrimary string
+	if prev != nil {
+		for _, member := range prev.Members {
+			old[member.Name] = member
+			if member.StateCode == replset.StatePrimary {
+				oldPrimary = member.Name
+			}
+		}
+	}
+
+	var primary string
+	for _, member := range result.Members {
+		if member.StateCode == replset.StatePrimary {
+			primary = member.Name
+		}
+
+		was, ok := old[member.Name]
+		delete(old, member.Name)
+		if !ok || was.State != member.State {
+			events = append(events, &statusEvent{
+				Time:   now,
+				Member: member.Name,
+				Event:  "state",
+				From:   was.State,
+				To:     member.State,
+			})
+		}
+		if ok && was.LagExceeded != member.LagExceeded {
+			events = append(events, &statusEvent{
+				Time:   now,
+				Member: member.Name,
+				Event:  "lag",
+				From:   (time.Duration(was.LagSeconds) * time.Second).String(),
+				To:     (time.Duration(member.LagSeconds) * time.Second).String(),
+			})
+		}
+	}
+
+	if prev == nil {
+		return events
+	}
+	if primary != oldPrimary {
+		member := primary
+		if len(member) == 0 {
+			member = oldPrimary
+		}
+		events = append(events, &statusEvent{
+			Time:   now,
+			Member: member,
+			Event:  "primary",
+			From:   oldPrimary,
+			To:     primary,
+		})
+	}
+	for _, member := range prev.Members {
+		if _, ok := old[member.Name]; ok {
+			events = append(events, &statusEvent{
+				Time:   now,
+				Member: member.Name,
+				Event:  "removed",
+				From:   member.State,
+			})
+		}
+	}
+	return events
 }
 
 func (c *StatusCommand) Help() string {
@@ -70,22 +236,35 @@ func (c *StatusCommand) Help() string {
 Usage: mongoctl status [options]
   Get the status of a Mongo Cluster
   This command connects to a Mongo server and retrieves the status
-	of the cluster.
+	of the cluster. Each member is shown with its replication lag behind
+  the primary, ping time and sync source, along with the oplog window
+  of the primary. Values beyond the thresholds are marked with "!".
 
 General Options:
-  -mongo=addr             The address of the Mongo server if not using Consul.
-
-  -consul-service=service The service name to use when looking up Mongo
-	                        with consul.
-
-	-consul-server=addr			The address of the consul server to use,
-	                        this defaults to 127.0.0.1:8500.
-  -consul                 Use consul to find Mongo
+  ` + generalOptionsUsage() + `
 
 Status Options:
 
 	-username=username      The username to authenticate with if required.
 
+  -max-lag=duration       Flag members further behind the primary than
+                          this. Defaults to 10s, 0 disables the check.
+
+  -min-oplog-window=duration
+                          Flag an oplog window on the primary shorter
+                          than this. Defaults to 24h, 0 disables the
+                          check.
+
+  -watch                  Keep polling the status until interrupted,
+                          redrawing the table and highlighting members
+                          whose state changed or whose lag grew. With
+                          json or yaml each poll is written in turn.
+
+  -interval=duration      How often to poll with -watch. Defaults to 2s.
+
+  -events                 With -watch, write each change, such as a new
+                          state or primary, as a line instead of
+                          redrawing the table.
 `
 	return strings.TrimSpace(helpText)
 }
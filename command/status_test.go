@@ -0,0 +1,172 @@
+package command
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aocsolutions/mongoctl/replset"
+	"github.com/nevins-b/commgo"
+)
+
+func TestDiffStatus(t *testing.T) {
+	member := func(name string, state int, lagExceeded bool) memberOutput {
+		return memberOutput{
+			Name:        name,
+			State:       stateStr(state),
+			StateCode:   state,
+			LagExceeded: lagExceeded,
+		}
+	}
+	status := func(members ...memberOutput) *statusOutput {
+		return &statusOutput{Set: "rs0", Members: members}
+	}
+
+	cases := []struct {
+		name     string
+		prev     *statusOutput
+		result   *statusOutput
+		expected []statusEvent
+	}{
+		{
+			name: "first poll",
+			result: status(
+				member("a", replset.StatePrimary, false),
+				member("b", replset.StateSecondary, false),
+			),
+			expected: []statusEvent{
+				{Member: "a", Event: "state", To: "PRIMARY"},
+				{Member: "b", Event: "state", To: "SECONDARY"},
+			},
+		},
+		{
+			name: "unchanged",
+			prev: status(
+				member("a", replset.StatePrimary, false),
+				member("b", replset.StateSecondary, false),
+			),
+			result: status(
+				member("a", replset.StatePrimary, false),
+				member("b", replset.StateSecondary, false),
+			),
+		},
+		{
+			name: "member goes down",
+			prev: status(
+				member("a", replset.StatePrimary, false),
+				member("b", replset.StateSecondary, false),
+			),
+			result: status(
+				member("a", replset.StatePrimary, false),
+				member("b", replset.StateDown, false),
+			),
+			expected: []statusEvent{
+				{Member: "b", Event: "state", From: "SECONDARY", To: "(not reachable/healthy)"},
+			},
+		},
+		{
+			name: "failover",
+			prev: status(
+				member("a", replset.StatePrimary, false),
+				member("b", replset.StateSecondary, false),
+			),
+			result: status(
+				member("a", replset.StateSecondary, false),
+				member("b", replset.StatePrimary, false),
+			),
+			expected: []statusEvent{
+				{Member: "a", Event: "state", From: "PRIMARY", To: "SECONDARY"},
+				{Member: "b", Event: "state", From: "SECONDARY", To: "PRIMARY"},
+				{Member: "b", Event: "primary", From: "a", To: "b"},
+			},
+		},
+		{
+			name: "primary lost",
+			prev: status(
+				member("a", replset.StatePrimary, false),
+				member("b", replset.StateSecondary, false),
+			),
+			result: status(
+				member("a", replset.StateDown, false),
+				member("b", replset.StateSecondary, false),
+			),
+			expected: []statusEvent{
+				{Member: "a", Event: "state", From: "PRIMARY", To: "(not reachable/healthy)"},
+				{Member: "a", Event: "primary", From: "a"},
+			},
+		},
+		{
+			name: "lag exceeded",
+			prev: status(
+				member("a", replset.StatePrimary, false),
+				member("b", replset.StateSecondary, false),
+			),
+			result: status(
+				member("a", replset.StatePrimary, false),
+				member("b", replset.StateSecondary, true),
+			),
+			expected: []statusEvent{
+				{Member: "b", Event: "lag", From: "0s", To: "0s"},
+			},
+		},
+		{
+			name: "member added and removed",
+			prev: status(
+				member("a", replset.StatePrimary, false),
+				member("b", replset.StateSecondary, false),
+			),
+			result: status(
+				member("a", replset.StatePrimary, false),
+				member("c", replset.StateSecondary, false),
+			),
+			expected: []statusEvent{
+				{Member: "c", Event: "state", To: "SECONDARY"},
+				{Member: "b", Event: "removed", From: "SECONDARY"},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		var events []statusEvent
+		for _, event := range diffStatus(tc.prev, tc.result) {
+			if event.Time.IsZero() {
+				t.Errorf("%s: event without a time: %#v", tc.name, event)
+			}
+			e := *event
+			e.Time = time.Time{}
+			events = append(events, e)
+		}
+		if !reflect.DeepEqual(events, tc.expected) {
+			t.Errorf("%s: expected %#v, got %#v", tc.name, tc.expected, events)
+		}
+	}
+}
+
+func TestNewStatusOutput_health(t *testing.T) {
+	status := &commgo.RsStatus{
+		Set: "rs0",
+		Members: []*commgo.RsMemberStats{
+			{Name: "a", State: replset.StatePrimary, StateStr: "PRIMARY", Health: 1},
+			{Name: "b", State: replset.StateRecovering, StateStr: "RECOVERING", Health: 1},
+			{Name: "c", State: replset.StateStartup2, StateStr: "STARTUP2", Health: 1},
+			{Name: "d", State: replset.StateDown, StateStr: "(not reachable/healthy)", Health: 0},
+		},
+	}
+
+	out := newStatusOutput(status, nil, statusThresholds{})
+	expected := []struct {
+		health bool
+		usable bool
+	}{
+		{true, true},
+		{true, false},
+		{true, false},
+		{false, false},
+	}
+	for i, member := range out.Members {
+		if member.Health != expected[i].health || member.Usable != expected[i].usable {
+			t.Errorf("%s: expected health %v and usable %v, got %v and %v", member.Name,
+				expected[i].health, expected[i].usable, member.Health, member.Usable)
+		}
+	}
+}
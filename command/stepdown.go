@@ -0,0 +1,95 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aocsolutions/mongoctl/replset"
+	"github.com/nevins-b/commgo"
+)
+
+type StepDownCommand struct {
+	Meta
+}
+
+func (c *StepDownCommand) Run(args []string) int {
+	var username string
+	var seconds int
+	var catchUp, timeout time.Duration
+	flags := c.Meta.FlagSet("stepdown", FlagSetDefault)
+	flags.Usage = func() { c.Ui.Error(c.Help()) }
+	flags.StringVar(&username, "username", "", "")
+	flags.IntVar(&seconds, "seconds", 60, "")
+	flags.DurationVar(&catchUp, "catch-up", 10*time.Second, "")
+	flags.DurationVar(&timeout, "timeout", time.Minute, "")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	client, err := c.Meta.Client(username, false)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+	defer client.Close()
+
+	status, err := client.Status()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+	old := replset.Primary(status)
+	if old == nil {
+		c.Ui.Error("Error: the replica set has no primary")
+		return 1
+	}
+
+	c.Ui.Info(fmt.Sprintf("Stepping down primary %s", old.Name))
+	if err := client.StepDown(seconds, int(catchUp/time.Second)); err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+
+	primary, err := replset.WaitForPrimaryOf(client, func(m *commgo.RsMemberStats) bool {
+		return m.Name != old.Name
+	}, timeout)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+	return c.Meta.output(&primaryOutput{
+		Previous: old.Name,
+		Primary:  primary.Name,
+	})
+}
+
+func (c *StepDownCommand) Help() string {
+	helpText := `
+Usage: mongoctl stepdown [options]
+  Step down the primary of a Mongo Replica Set.
+  This command connects to a Mongo server, asks the primary to step down
+  and waits until a different member is elected primary.
+
+General Options:
+  ` + generalOptionsUsage() + `
+
+Stepdown Options:
+
+  -username=username      The username to authenticate with if required.
+
+  -seconds=seconds        How long the old primary is ineligible to be
+                          elected again. Defaults to 60.
+
+  -catch-up=duration      How long to wait for a secondary to catch up
+                          before stepping down. Defaults to 10s.
+
+  -timeout=duration       How long to wait for the new primary.
+                          Defaults to 1m.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *StepDownCommand) Synopsis() string {
+	return "Step down the primary of a replica set"
+}
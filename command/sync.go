@@ -0,0 +1,280 @@
+package command
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aocsolutions/mongoctl/discovery"
+	"github.com/aocsolutions/mongoctl/replset"
+	"github.com/nevins-b/commgo"
+)
+
+type SyncCommand struct {
+	Meta
+
+	// now returns the current time, time.Now if nil.
+	now func() time.Time
+}
+
+// syncPolicy selects which kinds of drift sync fixes.
+type syncPolicy struct {
+	register   bool
+	deregister bool
+	removeDead bool
+	force      bool
+	grace      time.Duration
+	stateFile  string
+}
+
+func (c *SyncCommand) Run(args []string) int {
+	var username string
+	var all bool
+	var policy syncPolicy
+	flags := c.Meta.FlagSet("sync", FlagSetDefault|FlagSetDryRun)
+	flags.Usage = func() { c.Ui.Error(c.Help()) }
+	flags.StringVar(&username, "username", "", "")
+	flags.BoolVar(&policy.register, "register", false, "")
+	flags.BoolVar(&policy.deregister, "deregister", false, "")
+	flags.BoolVar(&policy.removeDead, "remove-dead", false, "")
+	flags.BoolVar(&all, "all", false, "")
+	flags.BoolVar(&policy.force, "force", false, "")
+	flags.DurationVar(&policy.grace, "grace", 5*time.Minute, "")
+	flags.StringVar(&policy.stateFile, "state-file", "", "")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	if all {
+		policy.register, policy.deregister, policy.removeDead = true, true, true
+	}
+
+	client, err := c.Meta.Client(username, false)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+	defer client.Close()
+
+	d, err := c.Meta.Discovery()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+	if d == nil {
+		c.Ui.Error("Error: sync requires a discovery backend")
+		return 1
+	}
+
+	registered, err := d.Lookup(c.Meta.serviceName)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+	config, err := client.GetConfig()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+	status, err := client.Status()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return 1
+	}
+
+	drift := newSetDrift(config, status, registered)
+	out := &syncOutput{
+		Set:     config.ID,
+		Version: config.Version,
+		Drift:   []syncEntry{},
+		DryRun:  c.Meta.dryRun,
+	}
+
+	// Remove dead members first so that their registrations are cleaned
+	// up with the stale ones.
+	if policy.removeDead {
+		removeAt, code := c.removeDead(client, d, config, status, registered, drift, &policy, out)
+		if code != 0 {
+			return code
+		}
+		for _, host := range drift.Dead {
+			entry := out.add(host, "dead")
+			entry.Action = "remove"
+			if at, ok := removeAt[host]; ok {
+				entry.Action = fmt.Sprintf("remove after %s", at.Format(time.RFC3339))
+			}
+		}
+	} else {
+		for _, host := range drift.Dead {
+			out.add(host, "dead")
+		}
+	}
+
+	for _, service := range drift.Stale {
+		entry := out.add(service.String(), "stale")
+		if !policy.deregister {
+			continue
+		}
+		c.Ui.Info(fmt.Sprintf("Deregistering %s, it is not a member of the set", service))
+		ok, err := c.Meta.deregister(d, service)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+			continue
+		}
+		if ok {
+			entry.Action = "deregister"
+		}
+	}
+
+	for _, host := range drift.Unregistered {
+		entry := out.add(host, "unregistered")
+		if !policy.register {
+			continue
+		}
+		addr, rawPort, err := net.SplitHostPort(host)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Can not parse node name %s", host))
+			continue
+		}
+		port, _ := strconv.Atoi(rawPort)
+		service := &discovery.Service{
+			ID:   host,
+			Addr: addr,
+			Port: port,
+		}
+		c.Meta.describe(service, config, status)
+		c.Ui.Info(fmt.Sprintf("Registering %s, it is a member of the set", service))
+		ok, err := c.Meta.register(d, service)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+			continue
+		}
+		if ok {
+			entry.Action = "register"
+		}
+	}
+
+	for _, host := range drift.Unhealthy {
+		out.add(host, "unhealthy")
+	}
+
+	return c.Meta.output(out)
+}
+
+// removeDead removes the members which have been DOWN for the grace
+// period, and marks their registrations stale. It returns when each of
+// the members still within the grace period will be removed. When each
+// member was first seen down is kept in the same state store as clean
+// uses, and is saved even if the removal fails.
+func (c *SyncCommand) removeDead(client replset.Client, d discovery.Discovery, config *commgo.RsConf, status *commgo.RsStatus,
+	registered []*discovery.Service, drift *setDrift, policy *syncPolicy, out *syncOutput) (map[string]time.Time, int) {
+	store, err := c.Meta.stateStore(d, policy.stateFile)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return nil, 1
+	}
+	history, err := loadDownHistory(store, c.Meta.serviceName)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+		return nil, 1
+	}
+
+	now := time.Now()
+	if c.now != nil {
+		now = c.now()
+	}
+	expired, pending := history.expire(drift.Dead, policy.grace, now)
+	removeAt := make(map[string]time.Time)
+	for _, host := range pending {
+		removeAt[host] = history[host].Add(policy.grace)
+	}
+
+	code := 0
+	if len(expired) > 0 {
+		code = 1
+		if c.Meta.checkRemove(config, status, policy.force, expired...) {
+			dead := make(map[string]bool)
+			for _, host := range expired {
+				c.Ui.Info(fmt.Sprintf("Removing dead host %s", host))
+				replset.RemoveMember(config, host)
+				dead[host] = true
+			}
+			if err := client.Reconfig(config); err != nil {
+				c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+			} else {
+				code = 0
+				out.Version = config.Version
+				for host := range dead {
+					delete(history, host)
+				}
+				for _, service := range registered {
+					if dead[service.String()] {
+						drift.Stale = append(drift.Stale, service)
+					}
+				}
+			}
+		}
+	}
+
+	if !c.Meta.dryRun {
+		if err := history.save(store, c.Meta.serviceName); err != nil {
+			c.Ui.Error(fmt.Sprintf("Error: %s", err.Error()))
+			return nil, 1
+		}
+	}
+	return removeAt, code
+}
+
+func (c *SyncCommand) Help() string {
+	helpText := `
+Usage: mongoctl sync [options]
+  Reconcile a discovery backend with a Mongo Replica Set.
+  This command compares the registrations in discovery with the members
+  of the set and their health, and reports members which aren't
+  registered, registrations which aren't members, members which are
+  DOWN and members which are otherwise unhealthy. Nothing is changed
+  unless the policy flags for a kind of drift are given.
+
+General Options:
+  ` + generalOptionsUsage() + `
+
+Sync Options:
+
+  -username=username      The username to authenticate with if required.
+
+  -register               Register healthy members which aren't
+                          registered.
+
+  -deregister             Deregister registrations which aren't members,
+                          including those of dead members removed by
+                          -remove-dead.
+
+  -remove-dead            Remove members which have been DOWN for the
+                          grace period from the set.
+
+  -all                    Fix every kind of drift, the same as giving
+                          -register, -deregister and -remove-dead.
+
+  -force                  Remove dead members even if the set would be
+                          left without a voting majority.
+
+  -grace=duration         How long a member must have been down before
+                          -remove-dead removes it. Until then it is
+                          reported with when it will be removed.
+                          Defaults to 5m, 0 removes dead members at once.
+
+  -state-file=path        The file to record when members were first seen
+                          down in, shared with clean. Defaults to the
+                          discovery backend if it can store state, such
+                          as consul KV, otherwise the state_file config
+                          or ~/.mongoctl-state.
+
+  ` + dryRunOptionsUsage() + `
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *SyncCommand) Synopsis() string {
+	return "Reconcile discovery with the members of a replica set"
+}
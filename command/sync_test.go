@@ -0,0 +1,160 @@
+package command
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aocsolutions/mongoctl/discovery"
+	"github.com/aocsolutions/mongoctl/replset"
+)
+
+func TestSyncCommand_report(t *testing.T) {
+	client, d := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+		testMember{"10.0.0.3:27017", replset.StateDown, 1},
+		testMember{"10.0.0.4:27017", replset.StateRecovering, 1},
+	)
+	d.Deregister("mongodb", &discovery.Service{ID: "10.0.0.2:27017"})
+	d.Register("mongodb", &discovery.Service{ID: "10.0.0.9:27017", Addr: "10.0.0.9", Port: 27017})
+
+	meta, ui := testMeta(client, d)
+	c := &SyncCommand{Meta: meta}
+	if code := c.Run([]string{"-format", "json"}); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+
+	var out syncOutput
+	if err := json.Unmarshal(ui.OutputWriter.Bytes(), &out); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := []syncEntry{
+		{Host: "10.0.0.3:27017", Drift: "dead"},
+		{Host: "10.0.0.9:27017", Drift: "stale"},
+		{Host: "10.0.0.2:27017", Drift: "unregistered"},
+		{Host: "10.0.0.4:27017", Drift: "unhealthy"},
+	}
+	if !reflect.DeepEqual(out.Drift, expected) {
+		t.Fatalf("expected drift %#v, got %#v", expected, out.Drift)
+	}
+	if len(client.Reconfigs) != 0 {
+		t.Fatalf("expected no reconfig, got %d", len(client.Reconfigs))
+	}
+	if ids := d.ids("mongodb"); len(ids) != 4 {
+		t.Fatalf("expected the registrations to be unchanged, got %v", ids)
+	}
+}
+
+func TestSyncCommand_all(t *testing.T) {
+	client, d := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+		testMember{"10.0.0.3:27017", replset.StateSecondary, 1},
+		testMember{"10.0.0.4:27017", replset.StateDown, 1},
+	)
+	d.Deregister("mongodb", &discovery.Service{ID: "10.0.0.2:27017"})
+	d.Register("mongodb", &discovery.Service{ID: "10.0.0.9:27017", Addr: "10.0.0.9", Port: 27017})
+
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	run := func() {
+		meta, ui := testMeta(client, d)
+		c := &SyncCommand{Meta: meta, now: func() time.Time { return now }}
+		if code := c.Run([]string{"-all", "-grace", "5m"}); code != 0 {
+			t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+		}
+	}
+
+	// The dead member is within its grace period, everything else is
+	// fixed at once.
+	run()
+	if len(client.Reconfigs) != 0 {
+		t.Fatalf("expected no reconfig within the grace period, got %d", len(client.Reconfigs))
+	}
+	expected := []string{"10.0.0.1:27017", "10.0.0.3:27017", "10.0.0.4:27017", "10.0.0.2:27017"}
+	if actual := d.ids("mongodb"); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected registrations %v, got %v", expected, actual)
+	}
+	services, _ := d.Lookup("mongodb")
+	if registered := services[3]; !registered.HasTag("secondary") || registered.Port != 27017 {
+		t.Fatalf("bad registration: %#v", registered)
+	}
+
+	now = now.Add(5 * time.Minute)
+	run()
+	expected = []string{"10.0.0.1:27017", "10.0.0.2:27017", "10.0.0.3:27017"}
+	if actual := hosts(client.Config); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected members %v, got %v", expected, actual)
+	}
+	expected = []string{"10.0.0.1:27017", "10.0.0.3:27017", "10.0.0.2:27017"}
+	if actual := d.ids("mongodb"); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected registrations %v, got %v", expected, actual)
+	}
+}
+
+func TestSyncCommand_recovered(t *testing.T) {
+	client, d := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+		testMember{"10.0.0.3:27017", replset.StateDown, 1},
+	)
+
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	run := func() {
+		meta, ui := testMeta(client, d)
+		c := &SyncCommand{Meta: meta, now: func() time.Time { return now }}
+		if code := c.Run([]string{"-remove-dead"}); code != 0 {
+			t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+		}
+	}
+
+	// A blip shorter than the grace period doesn't remove the member.
+	run()
+	client.State.Members[2].State = replset.StateSecondary
+	now = now.Add(3 * time.Minute)
+	run()
+	client.State.Members[2].State = replset.StateDown
+	now = now.Add(3 * time.Minute)
+	run()
+
+	if len(client.Reconfigs) != 0 {
+		t.Fatalf("expected no reconfig, got %d", len(client.Reconfigs))
+	}
+}
+
+func TestSyncCommand_noDiscovery(t *testing.T) {
+	client, _ := testSet(testMember{"10.0.0.1:27017", replset.StatePrimary, 1})
+	meta, _ := testMeta(client, nil)
+	c := &SyncCommand{Meta: meta}
+
+	if code := c.Run(nil); code != 1 {
+		t.Fatalf("expected failure without a discovery backend, got %d", code)
+	}
+}
+
+func TestSyncCommand_readOnly(t *testing.T) {
+	client, d := testSet(
+		testMember{"10.0.0.1:27017", replset.StatePrimary, 1},
+		testMember{"10.0.0.2:27017", replset.StateSecondary, 1},
+	)
+	d.Deregister("mongodb", &discovery.Service{ID: "10.0.0.2:27017"})
+	d.Register("mongodb", &discovery.Service{ID: "10.0.0.9:27017", Addr: "10.0.0.9", Port: 27017})
+	d.ReadOnly = true
+
+	meta, ui := testMeta(client, d)
+	c := &SyncCommand{Meta: meta}
+	if code := c.Run([]string{"-register", "-deregister", "-format", "json"}); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+
+	var out syncOutput
+	if err := json.Unmarshal(ui.OutputWriter.Bytes(), &out); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for _, entry := range out.Drift {
+		if len(entry.Action) > 0 {
+			t.Fatalf("expected no action on a read only backend, got %#v", entry)
+		}
+	}
+}
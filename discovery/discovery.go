@@ -0,0 +1,114 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// ErrReadOnly is returned by backends which can only be used to look
+// up services, not to register them.
+var ErrReadOnly = errors.New("discovery backend is read only")
+
+// Service is a single Mongo server registered with a discovery backend.
+type Service struct {
+	// ID uniquely identifies the registration within the backend.
+	ID   string
+	Addr string
+	Port int
+
+	// Tags are backend specific labels for the service, such as the
+	// role of the member.
+	Tags []string
+
+	// Meta holds key/value metadata for the service, such as the name
+	// of the replica set, for backends which support it.
+	Meta map[string]string
+}
+
+// String returns the host:port of the service as used in a replica
+// set configuration.
+func (s *Service) String() string {
+	return fmt.Sprintf("%s:%d", s.Addr, s.Port)
+}
+
+// Discovery is a backend that can be used to find the members of a
+// cluster and to keep the registered membership up to date.
+type Discovery interface {
+	// Lookup returns the services registered under name. No error
+	// is returned if there are none.
+	Lookup(name string) ([]*Service, error)
+
+	// Register adds service under name.
+	Register(name string, service *Service) error
+
+	// Deregister removes service from name.
+	Deregister(name string, service *Service) error
+}
+
+// Optioner is implemented by backends which publish connection
+// options alongside the members of a cluster.
+type Optioner interface {
+	// Options returns the connection options for name, such as
+	// replicaSet and authSource.
+	Options(name string) (url.Values, error)
+}
+
+// Seeder is implemented by backends which list the expected members
+// of a cluster rather than the running ones. Since a listed member does
+// not imply the replica set exists, Seed names the member which should
+// initialize it.
+type Seeder interface {
+	// Seed returns the member of name which initializes the cluster,
+	// or nil if there is none.
+	Seed(name string) (*Service, error)
+}
+
+// Locker is implemented by backends which provide a lock per cluster,
+// used to serialize changes to the membership between hosts.
+type Locker interface {
+	// Lock acquires the lock for name, waiting up to timeout. The
+	// returned function releases the lock.
+	Lock(name string, timeout time.Duration) (unlock func() error, err error)
+}
+
+// KeepAliver is implemented by backends whose registrations expire
+// unless they are refreshed.
+type KeepAliver interface {
+	// KeepAlive refreshes the registration with the given id until
+	// ctx is cancelled.
+	KeepAlive(ctx context.Context, name, id string) error
+}
+
+// Storer is implemented by backends which can keep small pieces of
+// state per cluster, such as when each member was first seen down.
+type Storer interface {
+	// Get returns the value of key for name, or nil if it isn't set.
+	Get(name, key string) ([]byte, error)
+
+	// Put sets key for name to value.
+	Put(name, key string, value []byte) error
+}
+
+// HasTag returns whether the service has the given tag.
+func (s *Service) HasTag(tag string) bool {
+	for _, t := range s.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Find returns the service in services with the given address and
+// port, or nil if there is none.
+func Find(services []*Service, addr string, port int) *Service {
+	for _, service := range services {
+		if service.Addr == addr && service.Port == port {
+			return service
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package replset
+
+import (
+	"errors"
+
+	"github.com/nevins-b/commgo"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ErrUnexpectedConfig is returned when local.system.replset holds more
+// than the single replica set configuration document.
+var ErrUnexpectedConfig = errors.New("local.system.replset has unexpected contents")
+
+// Client is the set of replica set operations used by the commands.
+// Session talks to a live mongod, Memory is an in-memory fake used to
+// exercise the commands without one.
+type Client interface {
+	// GetConfig returns the current replica set configuration.
+	GetConfig() (*commgo.RsConf, error)
+
+	// Reconfig bumps the version of the given configuration and
+	// applies it with replSetReconfig.
+	Reconfig(config *commgo.RsConf) error
+
+	// Status returns the output of replSetGetStatus.
+	Status() (*commgo.RsStatus, error)
+
+	// Initiate runs replSetInitiate on the connected node and
+	// returns the server response.
+	Initiate() (bson.M, error)
+
+	// StepDown asks the primary to step down for stepDownSecs,
+	// waiting up to catchUpSecs for a secondary to catch up.
+	StepDown(stepDownSecs, catchUpSecs int) error
+
+	// Freeze prevents the connected member from seeking election for
+	// the given number of seconds, 0 unfreezes it.
+	Freeze(seconds int) error
+
+	// OplogWindow returns the times of the first and last entries in
+	// the oplog of the primary.
+	OplogWindow() (*OplogWindow, error)
+
+	// Close releases any resources held by the client.
+	Close()
+}
+
+// FindMember returns the index of the member with the given host
+// in the configuration, or -1 if there is no such member.
+func FindMember(config *commgo.RsConf, host string) int {
+	for i, member := range config.Members {
+		if member.Host == host {
+			return i
+		}
+	}
+	return -1
+}
+
+// RemoveMember removes the member with the given host from the
+// configuration, returning whether it was present.
+func RemoveMember(config *commgo.RsConf, host string) bool {
+	i := FindMember(config, host)
+	if i < 0 {
+		return false
+	}
+	config.Members = append(config.Members[:i], config.Members[i+1:]...)
+	return true
+}
+
+// NextID returns the member id to use for a new member of the set.
+func NextID(config *commgo.RsConf) int64 {
+	var max int64
+	for _, member := range config.Members {
+		if member.ID > max {
+			max = member.ID
+		}
+	}
+	return max + 1
+}
+
+// CopyConfig returns a copy of config which can be changed without
+// affecting the original.
+func CopyConfig(config *commgo.RsConf) *commgo.RsConf {
+	out := *config
+	if config.Settings != nil {
+		settings := *config.Settings
+		out.Settings = &settings
+	}
+	out.Members = make([]*commgo.Host, len(config.Members))
+	for i, member := range config.Members {
+		host := *member
+		if member.Tags != nil {
+			host.Tags = make(map[string]string, len(member.Tags))
+			for k, v := range member.Tags {
+				host.Tags[k] = v
+			}
+		}
+		out.Members[i] = &host
+	}
+	return &out
+}
@@ -0,0 +1,65 @@
+package replset
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/nevins-b/commgo"
+)
+
+// DiffMember describes each attribute that differs between two
+// configurations of a member as "name: old => new".
+func DiffMember(have, want *commgo.Host) []string {
+	var fields []string
+	if have.ArbiterOnly != want.ArbiterOnly {
+		fields = append(fields, fmt.Sprintf("arbiterOnly: %v => %v", have.ArbiterOnly, want.ArbiterOnly))
+	}
+	if have.BuildIndexes != want.BuildIndexes {
+		fields = append(fields, fmt.Sprintf("buildIndexes: %v => %v", have.BuildIndexes, want.BuildIndexes))
+	}
+	if have.Priority != want.Priority {
+		fields = append(fields, fmt.Sprintf("priority: %v => %v", have.Priority, want.Priority))
+	}
+	if have.Votes != want.Votes {
+		fields = append(fields, fmt.Sprintf("votes: %d => %d", have.Votes, want.Votes))
+	}
+	if have.Hidden != want.Hidden {
+		fields = append(fields, fmt.Sprintf("hidden: %v => %v", have.Hidden, want.Hidden))
+	}
+	if have.SlaveDelay != want.SlaveDelay {
+		fields = append(fields, fmt.Sprintf("slaveDelay: %d => %d", have.SlaveDelay, want.SlaveDelay))
+	}
+	if !equalTags(have.Tags, want.Tags) {
+		fields = append(fields, fmt.Sprintf("tags: %s => %s", FormatTags(have.Tags), FormatTags(want.Tags)))
+	}
+	return fields
+}
+
+func equalTags(a, b map[string]string) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// FormatTags formats member tags sorted by key.
+func FormatTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(fmt.Sprintf("%s: %s", k, tags[k]))
+	}
+	buf.WriteString("}")
+	return buf.String()
+}
@@ -0,0 +1,121 @@
+package replset
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/nevins-b/commgo"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// DryRun wraps a Client so that reads go to the server but commands
+// which would change the set are only passed to Output.
+type DryRun struct {
+	Client Client
+	Output func(string)
+}
+
+func (d *DryRun) GetConfig() (*commgo.RsConf, error) {
+	return d.Client.GetConfig()
+}
+
+func (d *DryRun) Reconfig(config *commgo.RsConf) error {
+	config.Version++
+	return d.output(bson.D{{Name: "replSetReconfig", Value: config}})
+}
+
+func (d *DryRun) Status() (*commgo.RsStatus, error) {
+	return d.Client.Status()
+}
+
+func (d *DryRun) Initiate() (bson.M, error) {
+	if err := d.output(bson.D{{Name: "replSetInitiate", Value: ""}}); err != nil {
+		return nil, err
+	}
+	return bson.M{"dryRun": true}, nil
+}
+
+func (d *DryRun) StepDown(stepDownSecs, catchUpSecs int) error {
+	return d.output(bson.D{
+		{Name: "replSetStepDown", Value: stepDownSecs},
+		{Name: "secondaryCatchUpPeriodSecs", Value: catchUpSecs},
+	})
+}
+
+func (d *DryRun) Freeze(seconds int) error {
+	return d.output(bson.D{{Name: "replSetFreeze", Value: seconds}})
+}
+
+func (d *DryRun) OplogWindow() (*OplogWindow, error) {
+	return d.Client.OplogWindow()
+}
+
+func (d *DryRun) Close() {
+	d.Client.Close()
+}
+
+func (d *DryRun) output(cmd bson.D) error {
+	doc, err := FormatCommand(cmd)
+	if err != nil {
+		return err
+	}
+	d.Output(fmt.Sprintf("Would run %s:\n%s", cmd[0].Name, doc))
+	return nil
+}
+
+// FormatCommand renders a command as indented JSON, using the field
+// names it would have when sent to the server.
+func FormatCommand(cmd bson.D) (string, error) {
+	raw, err := bson.Marshal(cmd)
+	if err != nil {
+		return "", err
+	}
+	var doc bson.D
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return "", err
+	}
+	out, err := json.MarshalIndent(orderedDoc(doc), "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// orderedDoc is a bson.D which marshals to a JSON object keeping the
+// order of its fields.
+type orderedDoc bson.D
+
+func (o orderedDoc) MarshalJSON() ([]byte, error) {
+	buf := []byte{'{'}
+	for i, elem := range o {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		key, err := json.Marshal(elem.Name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(jsonValue(elem.Value))
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, key...)
+		buf = append(buf, ':')
+		buf = append(buf, value...)
+	}
+	return append(buf, '}'), nil
+}
+
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case bson.D:
+		return orderedDoc(v)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, elem := range v {
+			out[i] = jsonValue(elem)
+		}
+		return out
+	}
+	return v
+}
@@ -0,0 +1,201 @@
+package replset
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/nevins-b/commgo"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Memory is an in-memory Client. It keeps a configuration and status
+// which the commands read and modify, and records every configuration
+// passed to Reconfig so that callers can inspect what was applied. As
+// with a real set, Reconfig is rejected while the status has no
+// primary.
+type Memory struct {
+	Config *commgo.RsConf
+	State  *commgo.RsStatus
+
+	// Reconfigs holds a copy of each configuration applied.
+	Reconfigs []*commgo.RsConf
+
+	// Err, if set, is returned from every operation.
+	Err error
+
+	// Self is the member commands which act on a single member, such
+	// as Freeze, are applied to. Frozen holds when each frozen member
+	// may seek election again.
+	Self   string
+	Frozen map[string]time.Time
+
+	// Oplog is returned from OplogWindow.
+	Oplog *OplogWindow
+
+	lock sync.Mutex
+}
+
+func (m *Memory) GetConfig() (*commgo.RsConf, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	if m.Config == nil {
+		return nil, errors.New("not yet initialized")
+	}
+	return CopyConfig(m.Config), nil
+}
+
+func (m *Memory) Reconfig(config *commgo.RsConf) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.Err != nil {
+		return m.Err
+	}
+	if m.State != nil && Primary(m.State) == nil {
+		return errors.New("replSetReconfig should only be run on PRIMARY")
+	}
+	config.Version++
+	m.Config = CopyConfig(config)
+	m.Reconfigs = append(m.Reconfigs, CopyConfig(config))
+	return nil
+}
+
+func (m *Memory) Status() (*commgo.RsStatus, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	if m.State == nil {
+		return &commgo.RsStatus{}, nil
+	}
+
+	// A member which was just initiated is elected by the time the
+	// status is first polled.
+	for _, member := range m.State.Members {
+		if member.State == StateStartup2 && len(m.State.Members) == 1 {
+			member.State = StatePrimary
+			member.StateStr = "PRIMARY"
+		}
+	}
+	status := *m.State
+	status.Members = make([]*commgo.RsMemberStats, len(m.State.Members))
+	for i, member := range m.State.Members {
+		stats := *member
+		status.Members[i] = &stats
+	}
+	return &status, nil
+}
+
+func (m *Memory) Initiate() (bson.M, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	if m.Config != nil {
+		return nil, errors.New("already initialized")
+	}
+	m.Config = &commgo.RsConf{Version: 1}
+
+	// Initiate the set with Self as its only member, which isn't
+	// primary until it has been elected.
+	if len(m.Self) > 0 {
+		m.Config.Members = []*commgo.Host{{
+			ID:           0,
+			Host:         m.Self,
+			BuildIndexes: true,
+			Votes:        1,
+			Priority:     1,
+		}}
+		m.State = &commgo.RsStatus{
+			Members: []*commgo.RsMemberStats{{
+				Name:     m.Self,
+				State:    StateStartup2,
+				StateStr: "STARTUP2",
+				Self:     true,
+			}},
+		}
+	}
+	return bson.M{"ok": 1}, nil
+}
+
+// StepDown makes the primary a secondary and elects the electable
+// secondary with the highest priority in its place.
+func (m *Memory) StepDown(stepDownSecs, catchUpSecs int) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.Err != nil {
+		return m.Err
+	}
+	if m.State == nil {
+		return errors.New("no primary")
+	}
+	old := Primary(m.State)
+	if old == nil {
+		return errors.New("no primary")
+	}
+	old.State = StateSecondary
+	old.StateStr = "SECONDARY"
+
+	var next *commgo.RsMemberStats
+	var best float64
+	for _, member := range m.State.Members {
+		if member == old || member.State != StateSecondary || m.Config == nil {
+			continue
+		}
+		i := FindMember(m.Config, member.Name)
+		if i < 0 {
+			continue
+		}
+		cfg := m.Config.Members[i]
+		if cfg.Priority > best && m.Frozen[member.Name].Before(time.Now()) {
+			next = member
+			best = cfg.Priority
+		}
+	}
+	if next != nil {
+		next.State = StatePrimary
+		next.StateStr = "PRIMARY"
+	}
+	return nil
+}
+
+// Freeze records the freeze against the member named by Self.
+func (m *Memory) Freeze(seconds int) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.Err != nil {
+		return m.Err
+	}
+	if m.Frozen == nil {
+		m.Frozen = make(map[string]time.Time)
+	}
+	m.Frozen[m.Self] = time.Now().Add(time.Duration(seconds) * time.Second)
+	return nil
+}
+
+func (m *Memory) OplogWindow() (*OplogWindow, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	if m.Oplog == nil {
+		return nil, errors.New("no oplog")
+	}
+	oplog := *m.Oplog
+	return &oplog, nil
+}
+
+func (m *Memory) Close() {}
@@ -0,0 +1,26 @@
+package replset
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// OplogWindow is the span of time covered by the oplog. A member which
+// falls further behind the primary than the window can not catch up
+// and must be resynced.
+type OplogWindow struct {
+	First time.Time
+	Last  time.Time
+}
+
+// Duration returns the length of the window.
+func (o *OplogWindow) Duration() time.Duration {
+	return o.Last.Sub(o.First)
+}
+
+// timestamp converts an oplog timestamp, which holds seconds since the
+// epoch in its upper 32 bits, to a time.
+func timestamp(ts bson.MongoTimestamp) time.Time {
+	return time.Unix(int64(ts)>>32, 0)
+}
@@ -0,0 +1,132 @@
+package replset
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nevins-b/commgo"
+)
+
+// Quorum summarises the voting members of a replica set and how many
+// of them are currently up.
+type Quorum struct {
+	// Voters is the number of voting members in the configuration.
+	Voters int
+
+	// Healthy is the number of voting members which are PRIMARY,
+	// SECONDARY or ARBITER.
+	Healthy int
+
+	// Arbiters is the number of voting arbiters.
+	Arbiters int
+}
+
+// NewQuorum computes the quorum of the set from its configuration and
+// status.
+func NewQuorum(config *commgo.RsConf, status *commgo.RsStatus) *Quorum {
+	q := &Quorum{}
+	for _, member := range config.Members {
+		if member.Votes == 0 {
+			continue
+		}
+		q.Voters++
+		if member.ArbiterOnly {
+			q.Arbiters++
+		}
+		if stats := FindStats(status, member.Host); stats != nil && Healthy(stats) {
+			q.Healthy++
+		}
+	}
+	return q
+}
+
+// Majority returns the number of votes needed to elect a primary.
+func (q *Quorum) Majority() int {
+	return q.Voters/2 + 1
+}
+
+// HasMajority returns whether enough voters are up to elect a primary.
+func (q *Quorum) HasMajority() bool {
+	return q.Healthy >= q.Majority()
+}
+
+// Healthy returns whether a member is up and usable by the set.
+func Healthy(stats *commgo.RsMemberStats) bool {
+	switch stats.State {
+	case StatePrimary, StateSecondary, StateArbiter:
+		return true
+	}
+	return false
+}
+
+// FindStats returns the status of the member with the given name, or
+// nil if it isn't in the status.
+func FindStats(status *commgo.RsStatus, name string) *commgo.RsMemberStats {
+	for _, member := range status.Members {
+		if member.Name == name {
+			return member
+		}
+	}
+	return nil
+}
+
+// String describes the quorum for display.
+func (q *Quorum) String() string {
+	return fmt.Sprintf("%d voting members (%d arbiters), %d healthy, %d needed for a majority",
+		q.Voters, q.Arbiters, q.Healthy, q.Majority())
+}
+
+// CheckRemove returns an error if removing hosts from the set would
+// remove the current primary or leave the set without enough healthy
+// voters to elect a primary. The quorum after the removal is returned
+// so it can be reported.
+func CheckRemove(config *commgo.RsConf, status *commgo.RsStatus, hosts ...string) (*Quorum, error) {
+	after := *config
+	after.Members = nil
+	for _, member := range config.Members {
+		removed := false
+		for _, host := range hosts {
+			if member.Host == host {
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			after.Members = append(after.Members, member)
+		}
+	}
+
+	if primary := Primary(status); primary != nil {
+		for _, host := range hosts {
+			if host == primary.Name {
+				return nil, fmt.Errorf("%s is the primary, step it down before removing it", host)
+			}
+		}
+	}
+
+	quorum := NewQuorum(&after, status)
+	if quorum.Voters == 0 {
+		return quorum, fmt.Errorf("removing %s would leave no voting members", strings.Join(hosts, ", "))
+	}
+	if !quorum.HasMajority() {
+		return quorum, fmt.Errorf("removing %s would leave %d healthy of %d voting members, %d are needed for a majority",
+			strings.Join(hosts, ", "), quorum.Healthy, quorum.Voters, quorum.Majority())
+	}
+	return quorum, nil
+}
+
+// CheckReconfig returns an error if the set has no primary to accept
+// config, or if the voting members of config which are healthy would
+// not be a majority. The quorum of config is returned so it can be
+// reported.
+func CheckReconfig(config *commgo.RsConf, status *commgo.RsStatus) (*Quorum, error) {
+	if Primary(status) == nil {
+		return nil, fmt.Errorf("the replica set has no primary")
+	}
+	quorum := NewQuorum(config, status)
+	if !quorum.HasMajority() {
+		return quorum, fmt.Errorf("the new configuration would have %d healthy of %d voting members, %d are needed for a majority",
+			quorum.Healthy, quorum.Voters, quorum.Majority())
+	}
+	return quorum, nil
+}
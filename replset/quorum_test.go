@@ -0,0 +1,175 @@
+package replset
+
+import (
+	"testing"
+
+	"github.com/nevins-b/commgo"
+)
+
+// testMember describes a member of a test replica set.
+type testMember struct {
+	host    string
+	state   int
+	votes   int
+	arbiter bool
+}
+
+func testSet(members ...testMember) (*commgo.RsConf, *commgo.RsStatus) {
+	config := &commgo.RsConf{ID: "rs0", Version: 1}
+	status := &commgo.RsStatus{Set: "rs0"}
+	for i, member := range members {
+		priority := 1.0
+		if member.arbiter || member.votes == 0 {
+			priority = 0
+		}
+		config.Members = append(config.Members, &commgo.Host{
+			ID:           int64(i),
+			Host:         member.host,
+			ArbiterOnly:  member.arbiter,
+			BuildIndexes: true,
+			Votes:        member.votes,
+			Priority:     priority,
+		})
+		status.Members = append(status.Members, &commgo.RsMemberStats{
+			Name:  member.host,
+			State: member.state,
+		})
+	}
+	return config, status
+}
+
+func TestNewQuorum(t *testing.T) {
+	config, status := testSet(
+		testMember{"a", StatePrimary, 1, false},
+		testMember{"b", StateSecondary, 1, false},
+		testMember{"c", StateDown, 1, false},
+		testMember{"d", StateArbiter, 1, true},
+		testMember{"e", StateSecondary, 0, false},
+	)
+
+	q := NewQuorum(config, status)
+	expected := Quorum{Voters: 4, Healthy: 3, Arbiters: 1}
+	if *q != expected {
+		t.Fatalf("expected %#v, got %#v", expected, *q)
+	}
+	if q.Majority() != 3 || !q.HasMajority() {
+		t.Fatalf("expected a majority of 3 to be met: %s", q)
+	}
+}
+
+func TestCheckRemove(t *testing.T) {
+	cases := []struct {
+		name    string
+		members []testMember
+		remove  []string
+		err     bool
+	}{
+		{
+			name: "healthy secondary",
+			members: []testMember{
+				{"a", StatePrimary, 1, false},
+				{"b", StateSecondary, 1, false},
+				{"c", StateSecondary, 1, false},
+			},
+			remove: []string{"c"},
+		},
+		{
+			name: "primary",
+			members: []testMember{
+				{"a", StatePrimary, 1, false},
+				{"b", StateSecondary, 1, false},
+				{"c", StateSecondary, 1, false},
+			},
+			remove: []string{"a"},
+			err:    true,
+		},
+		{
+			name: "majority loss",
+			members: []testMember{
+				{"a", StatePrimary, 1, false},
+				{"b", StateSecondary, 1, false},
+				{"c", StateDown, 1, false},
+				{"d", StateDown, 1, false},
+			},
+			remove: []string{"b"},
+			err:    true,
+		},
+		{
+			name: "down members",
+			members: []testMember{
+				{"a", StatePrimary, 1, false},
+				{"b", StateSecondary, 1, false},
+				{"c", StateDown, 1, false},
+				{"d", StateDown, 1, false},
+				{"e", StateDown, 1, false},
+			},
+			remove: []string{"c", "d", "e"},
+		},
+		{
+			name: "arbiter keeps the majority",
+			members: []testMember{
+				{"a", StatePrimary, 1, false},
+				{"b", StateSecondary, 1, false},
+				{"c", StateDown, 1, false},
+				{"d", StateArbiter, 1, true},
+			},
+			remove: []string{"b"},
+		},
+		{
+			name: "down arbiter",
+			members: []testMember{
+				{"a", StatePrimary, 1, false},
+				{"b", StateSecondary, 1, false},
+				{"c", StateDown, 1, false},
+				{"d", StateDown, 1, true},
+			},
+			remove: []string{"b"},
+			err:    true,
+		},
+		{
+			name: "zero-vote members don't count",
+			members: []testMember{
+				{"a", StatePrimary, 1, false},
+				{"b", StateSecondary, 1, false},
+				{"c", StateDown, 1, false},
+				{"d", StateSecondary, 0, false},
+				{"e", StateSecondary, 0, false},
+			},
+			remove: []string{"b"},
+			err:    true,
+		},
+		{
+			name: "zero-vote member",
+			members: []testMember{
+				{"a", StatePrimary, 1, false},
+				{"b", StateSecondary, 1, false},
+				{"c", StateDown, 1, false},
+				{"d", StateSecondary, 0, false},
+			},
+			remove: []string{"d"},
+		},
+		{
+			name: "no voting members left",
+			members: []testMember{
+				{"a", StateSecondary, 1, false},
+				{"b", StateSecondary, 0, false},
+			},
+			remove: []string{"a"},
+			err:    true,
+		},
+	}
+
+	for _, tc := range cases {
+		config, status := testSet(tc.members...)
+		_, err := CheckRemove(config, status, tc.remove...)
+		if tc.err && err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+		if !tc.err && err != nil {
+			t.Errorf("%s: unexpected error: %s", tc.name, err)
+		}
+		if len(config.Members) != len(tc.members) {
+			t.Errorf("%s: config was modified", tc.name)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package replset
+
+import (
+	"io"
+
+	"github.com/nevins-b/commgo"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Session is a Client backed by a mgo session.
+type Session struct {
+	session *mgo.Session
+}
+
+// Dial connects to the server described by info. When info.Direct is
+// set the session is put in Monotonic mode so that commands can be run
+// against a node which is not yet part of a replica set.
+func Dial(info *mgo.DialInfo) (*Session, error) {
+	session, err := mgo.DialWithInfo(info)
+	if err != nil {
+		return nil, err
+	}
+	if info.Direct {
+		session.SetMode(mgo.Monotonic, true)
+	}
+	return &Session{session: session}, nil
+}
+
+func (s *Session) GetConfig() (*commgo.RsConf, error) {
+	conn := s.session.DB("local").C("system.replset")
+	count, err := conn.Count()
+	if err != nil {
+		s.session.Refresh()
+		return nil, err
+	}
+	if count > 1 {
+		return nil, ErrUnexpectedConfig
+	}
+
+	config := &commgo.RsConf{}
+	if err := conn.Find(bson.M{}).One(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (s *Session) Reconfig(config *commgo.RsConf) error {
+	config.Version++
+
+	cmd := &bson.M{
+		"replSetReconfig": config,
+	}
+	result := bson.M{}
+	return s.session.DB("admin").Run(cmd, &result)
+}
+
+func (s *Session) Status() (*commgo.RsStatus, error) {
+	status := &commgo.RsStatus{}
+	if err := s.session.DB("admin").Run("replSetGetStatus", status); err != nil {
+		// The connection may have been dropped by an election, so
+		// let the next call reconnect.
+		s.session.Refresh()
+		return nil, err
+	}
+	return status, nil
+}
+
+func (s *Session) Initiate() (bson.M, error) {
+	cmd := &bson.M{
+		"replSetInitiate": "",
+	}
+	result := bson.M{}
+	if err := s.session.DB("admin").Run(cmd, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *Session) StepDown(stepDownSecs, catchUpSecs int) error {
+	cmd := &bson.D{
+		{Name: "replSetStepDown", Value: stepDownSecs},
+		{Name: "secondaryCatchUpPeriodSecs", Value: catchUpSecs},
+	}
+	result := bson.M{}
+	err := s.session.DB("admin").Run(cmd, &result)
+
+	// Older servers close every connection when stepping down, so the
+	// command appears to fail even though it succeeded.
+	if err == io.EOF {
+		err = nil
+	}
+	s.session.Refresh()
+	return err
+}
+
+func (s *Session) Freeze(seconds int) error {
+	cmd := &bson.M{
+		"replSetFreeze": seconds,
+	}
+	result := bson.M{}
+	return s.session.DB("admin").Run(cmd, &result)
+}
+
+func (s *Session) OplogWindow() (*OplogWindow, error) {
+	var first, last struct {
+		Ts bson.MongoTimestamp `bson:"ts"`
+	}
+	oplog := s.session.DB("local").C("oplog.rs")
+	if err := oplog.Find(nil).Sort("$natural").One(&first); err != nil {
+		s.session.Refresh()
+		return nil, err
+	}
+	if err := oplog.Find(nil).Sort("-$natural").One(&last); err != nil {
+		s.session.Refresh()
+		return nil, err
+	}
+	return &OplogWindow{
+		First: timestamp(first.Ts),
+		Last:  timestamp(last.Ts),
+	}, nil
+}
+
+func (s *Session) Close() {
+	s.session.Close()
+}
@@ -0,0 +1,100 @@
+package replset
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nevins-b/commgo"
+)
+
+// Member states as reported by replSetGetStatus.
+const (
+	StateStartup    = 0
+	StatePrimary    = 1
+	StateSecondary  = 2
+	StateRecovering = 3
+	StateStartup2   = 5
+	StateUnknown    = 6
+	StateArbiter    = 7
+	StateDown       = 8
+	StateRollback   = 9
+	StateRemoved    = 10
+)
+
+// Primary returns the member of status which is PRIMARY, or nil if
+// the set has no primary.
+func Primary(status *commgo.RsStatus) *commgo.RsMemberStats {
+	for _, member := range status.Members {
+		if member.State == StatePrimary {
+			return member
+		}
+	}
+	return nil
+}
+
+// Lag returns how far behind the primary the member is, or 0 if the
+// set has no primary or the member has no optime, as with arbiters
+// and unreachable members.
+func Lag(status *commgo.RsStatus, member *commgo.RsMemberStats) time.Duration {
+	primary := Primary(status)
+	if primary == nil || member.State == StateArbiter || member.OptimeDate.IsZero() {
+		return 0
+	}
+	lag := primary.OptimeDate.Sub(member.OptimeDate)
+	if lag < 0 {
+		return 0
+	}
+	return lag
+}
+
+// WaitForPrimary polls the status of the set until a primary is
+// observed, returning an error if none is seen within timeout.
+func WaitForPrimary(client Client, timeout time.Duration) (*commgo.RsMemberStats, error) {
+	return WaitForPrimaryOf(client, nil, timeout)
+}
+
+// WaitForPrimaryOf polls the status of the set until a primary for
+// which accept returns true is observed, returning an error if none is
+// seen within timeout. A nil accept accepts any primary.
+func WaitForPrimaryOf(client Client, accept func(*commgo.RsMemberStats) bool, timeout time.Duration) (*commgo.RsMemberStats, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		status, err := client.Status()
+		if err == nil {
+			primary := Primary(status)
+			if primary != nil && (accept == nil || accept(primary)) {
+				return primary, nil
+			}
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("No primary elected within %s", timeout)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// Roles returns the roles of a member, used to tag its registration in
+// discovery: primary or secondary from its state, and arbiter or hidden
+// from its configuration. A member in any other state has no role from
+// its state.
+func Roles(member *commgo.Host, stats *commgo.RsMemberStats) []string {
+	var roles []string
+	if stats != nil {
+		switch stats.State {
+		case StatePrimary:
+			roles = append(roles, "primary")
+		case StateSecondary:
+			roles = append(roles, "secondary")
+		}
+	}
+	if member != nil && member.ArbiterOnly {
+		roles = append(roles, "arbiter")
+	}
+	if member != nil && member.Hidden {
+		roles = append(roles, "hidden")
+	}
+	return roles
+}
@@ -0,0 +1,97 @@
+package replset
+
+import (
+	"fmt"
+
+	"github.com/nevins-b/commgo"
+)
+
+const (
+	// MaxMembers is the largest number of members of a replica set.
+	MaxMembers = 50
+
+	// MaxVotingMembers is the largest number of voting members.
+	MaxVotingMembers = 7
+)
+
+// ValidateMember checks a member for combinations of settings that
+// replSetReconfig would reject.
+func ValidateMember(member *commgo.Host) error {
+	if member.Priority < 0 || member.Priority > 1000 {
+		return fmt.Errorf("%s: priority must be between 0 and 1000", member.Host)
+	}
+	if member.Votes != 0 && member.Votes != 1 {
+		return fmt.Errorf("%s: votes must be 0 or 1", member.Host)
+	}
+	if member.SlaveDelay < 0 {
+		return fmt.Errorf("%s: slave delay can not be negative", member.Host)
+	}
+
+	if member.ArbiterOnly {
+		if member.Priority > 0 {
+			return fmt.Errorf("%s: arbiters must have priority 0", member.Host)
+		}
+		if member.Hidden {
+			return fmt.Errorf("%s: arbiters can not be hidden", member.Host)
+		}
+		if member.SlaveDelay > 0 {
+			return fmt.Errorf("%s: arbiters can not be delayed", member.Host)
+		}
+		return nil
+	}
+
+	if member.Priority > 0 {
+		switch {
+		case member.Hidden:
+			return fmt.Errorf("%s: hidden members must have priority 0", member.Host)
+		case member.SlaveDelay > 0:
+			return fmt.Errorf("%s: delayed members must have priority 0", member.Host)
+		case member.Votes == 0:
+			return fmt.Errorf("%s: non-voting members must have priority 0", member.Host)
+		case !member.BuildIndexes:
+			return fmt.Errorf("%s: members that don't build indexes must have priority 0", member.Host)
+		}
+	}
+	return nil
+}
+
+// ValidateConfig checks every member of config, and the limits on the
+// set as a whole.
+func ValidateConfig(config *commgo.RsConf) error {
+	if len(config.Members) > MaxMembers {
+		return fmt.Errorf("A replica set can have at most %d members", MaxMembers)
+	}
+
+	hosts := make(map[string]bool)
+	ids := make(map[int64]bool)
+	voting := 0
+	electable := 0
+	for _, member := range config.Members {
+		if hosts[member.Host] {
+			return fmt.Errorf("%s: host is listed more than once", member.Host)
+		}
+		hosts[member.Host] = true
+		if ids[member.ID] {
+			return fmt.Errorf("%s: member id %d is used more than once", member.Host, member.ID)
+		}
+		ids[member.ID] = true
+
+		if err := ValidateMember(member); err != nil {
+			return err
+		}
+		if member.Votes > 0 {
+			voting++
+		}
+		if member.Priority > 0 {
+			electable++
+		}
+	}
+
+	if voting > MaxVotingMembers {
+		return fmt.Errorf("A replica set can have at most %d voting members", MaxVotingMembers)
+	}
+	if len(config.Members) > 0 && electable == 0 {
+		return fmt.Errorf("A replica set needs at least one member with priority above 0")
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package replset
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nevins-b/commgo"
+)
+
+func TestValidateMember(t *testing.T) {
+	cases := []struct {
+		name   string
+		member commgo.Host
+		err    bool
+	}{
+		{
+			name:   "default",
+			member: commgo.Host{Priority: 1, Votes: 1, BuildIndexes: true},
+		},
+		{
+			name:   "priority too high",
+			member: commgo.Host{Priority: 1001, Votes: 1, BuildIndexes: true},
+			err:    true,
+		},
+		{
+			name:   "negative priority",
+			member: commgo.Host{Priority: -1, Votes: 1, BuildIndexes: true},
+			err:    true,
+		},
+		{
+			name:   "two votes",
+			member: commgo.Host{Priority: 1, Votes: 2, BuildIndexes: true},
+			err:    true,
+		},
+		{
+			name:   "arbiter",
+			member: commgo.Host{ArbiterOnly: true, Votes: 1, BuildIndexes: true},
+		},
+		{
+			name:   "arbiter with priority",
+			member: commgo.Host{ArbiterOnly: true, Priority: 1, Votes: 1, BuildIndexes: true},
+			err:    true,
+		},
+		{
+			name:   "hidden arbiter",
+			member: commgo.Host{ArbiterOnly: true, Hidden: true, Votes: 1, BuildIndexes: true},
+			err:    true,
+		},
+		{
+			name:   "delayed arbiter",
+			member: commgo.Host{ArbiterOnly: true, SlaveDelay: 60, Votes: 1, BuildIndexes: true},
+			err:    true,
+		},
+		{
+			name:   "hidden",
+			member: commgo.Host{Hidden: true, Votes: 1, BuildIndexes: true},
+		},
+		{
+			name:   "hidden with priority",
+			member: commgo.Host{Hidden: true, Priority: 1, Votes: 1, BuildIndexes: true},
+			err:    true,
+		},
+		{
+			name:   "delayed with priority",
+			member: commgo.Host{SlaveDelay: 60, Priority: 1, Votes: 1, BuildIndexes: true},
+			err:    true,
+		},
+		{
+			name:   "zero-vote",
+			member: commgo.Host{Votes: 0, BuildIndexes: true},
+		},
+		{
+			name:   "zero-vote with priority",
+			member: commgo.Host{Priority: 1, Votes: 0, BuildIndexes: true},
+			err:    true,
+		},
+		{
+			name:   "without indexes with priority",
+			member: commgo.Host{Priority: 1, Votes: 1},
+			err:    true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc.member.Host = "a:27017"
+		err := ValidateMember(&tc.member)
+		if tc.err && err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+		if !tc.err && err != nil {
+			t.Errorf("%s: unexpected error: %s", tc.name, err)
+		}
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	member := func(id int64, votes int, priority float64) *commgo.Host {
+		return &commgo.Host{
+			ID:           id,
+			Host:         fmt.Sprintf("10.0.0.%d:27017", id),
+			BuildIndexes: true,
+			Votes:        votes,
+			Priority:     priority,
+		}
+	}
+	members := func(n, votes int) []*commgo.Host {
+		var hosts []*commgo.Host
+		for i := 0; i < n; i++ {
+			v, p := 0, 0.0
+			if i < votes {
+				v, p = 1, 1
+			}
+			hosts = append(hosts, member(int64(i), v, p))
+		}
+		return hosts
+	}
+
+	cases := []struct {
+		name    string
+		members []*commgo.Host
+		err     bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:    "three members",
+			members: members(3, 3),
+		},
+		{
+			name:    "seven voting members",
+			members: members(7, 7),
+		},
+		{
+			name:    "eight voting members",
+			members: members(8, 8),
+			err:     true,
+		},
+		{
+			name:    "zero-vote members beyond seven",
+			members: members(12, 7),
+		},
+		{
+			name:    "fifty members",
+			members: members(MaxMembers, 7),
+		},
+		{
+			name:    "too many members",
+			members: members(MaxMembers+1, 7),
+			err:     true,
+		},
+		{
+			name:    "no electable member",
+			members: []*commgo.Host{member(0, 1, 0), member(1, 1, 0)},
+			err:     true,
+		},
+		{
+			name: "arbiter is not electable",
+			members: []*commgo.Host{
+				member(0, 1, 0),
+				{ID: 1, Host: "10.0.0.1:27017", ArbiterOnly: true, Votes: 1, BuildIndexes: true},
+			},
+			err: true,
+		},
+		{
+			name:    "duplicate host",
+			members: []*commgo.Host{member(0, 1, 1), {ID: 1, Host: "10.0.0.0:27017", Votes: 1, Priority: 1, BuildIndexes: true}},
+			err:     true,
+		},
+		{
+			name:    "duplicate id",
+			members: []*commgo.Host{member(0, 1, 1), {ID: 0, Host: "10.0.0.1:27017", Votes: 1, Priority: 1, BuildIndexes: true}},
+			err:     true,
+		},
+		{
+			name:    "invalid member",
+			members: []*commgo.Host{member(0, 1, 1), member(1, 0, 1)},
+			err:     true,
+		},
+	}
+
+	for _, tc := range cases {
+		err := ValidateConfig(&commgo.RsConf{ID: "rs0", Members: tc.members})
+		if tc.err && err == nil {
+			t.Errorf("%s: expected an error", tc.name)
+		}
+		if !tc.err && err != nil {
+			t.Errorf("%s: unexpected error: %s", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package spec
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/aocsolutions/mongoctl/replset"
+	"github.com/nevins-b/commgo"
+)
+
+// Change actions.
+const (
+	ActionAdd     = "add"
+	ActionRemove  = "remove"
+	ActionModify  = "modify"
+	ActionReplace = "replace"
+)
+
+// Change is the difference for a single member between the live
+// configuration and the spec.
+type Change struct {
+	Action string
+	Host   string
+
+	// Fields describes each changed attribute as "name: old => new".
+	Fields []string
+}
+
+// Step is a single replSetReconfig to perform, with the full
+// configuration to apply.
+type Step struct {
+	Description string
+	Config      *commgo.RsConf
+}
+
+// Plan is the set of changes between the live configuration and a spec
+// and the sequence of reconfigs that applies them.
+type Plan struct {
+	Changes []*Change
+	Steps   []*Step
+}
+
+// Empty returns whether there is nothing to change.
+func (p *Plan) Empty() bool {
+	return len(p.Steps) == 0
+}
+
+// String formats the changes for display, in the style of a diff.
+func (p *Plan) String() string {
+	var buf bytes.Buffer
+	for _, change := range p.Changes {
+		switch change.Action {
+		case ActionAdd:
+			buf.WriteString(fmt.Sprintf("+ %s\n", change.Host))
+		case ActionRemove:
+			buf.WriteString(fmt.Sprintf("- %s\n", change.Host))
+		case ActionModify:
+			buf.WriteString(fmt.Sprintf("~ %s\n", change.Host))
+		case ActionReplace:
+			buf.WriteString(fmt.Sprintf("-/+ %s\n", change.Host))
+		default:
+			buf.WriteString(fmt.Sprintf("%s\n", change.Host))
+		}
+		for _, field := range change.Fields {
+			buf.WriteString(fmt.Sprintf("    %s\n", field))
+		}
+	}
+	return buf.String()
+}
+
+// Diff computes the plan to move the live configuration to the spec.
+//
+// MongoDB only allows one voting member to be added or removed per
+// reconfig, and some attributes can not be changed in place, so the
+// changes are split into steps: first all in place changes which don't
+// affect votes along with settings, then new members, then vote changes
+// one member at a time, then removed members, and finally members which
+// had to be removed to change arbiterOnly or buildIndexes. Non-voting
+// members are added and removed together, voting ones one per step.
+//
+// Members are added before any are removed so the set never has fewer
+// voters than it needs during the change.
+func Diff(live *commgo.RsConf, spec *Spec) (*Plan, error) {
+	if spec.Name != "" && spec.Name != live.ID {
+		return nil, fmt.Errorf("Spec is for replica set %s but connected to %s", spec.Name, live.ID)
+	}
+
+	plan := &Plan{}
+	cur := replset.CopyConfig(live)
+
+	desired := make(map[string]*commgo.Host)
+	var order []string
+	for _, member := range spec.Members {
+		desired[member.Host] = member.Config(0)
+		order = append(order, member.Host)
+	}
+
+	var adds, replaces, removes, votes []*commgo.Host
+
+	// In place changes
+	modified := false
+	for _, member := range cur.Members {
+		want, ok := desired[member.Host]
+		if !ok {
+			removes = append(removes, member)
+			continue
+		}
+		if member.ArbiterOnly != want.ArbiterOnly || member.BuildIndexes != want.BuildIndexes {
+			plan.Changes = append(plan.Changes, &Change{
+				Action: ActionReplace,
+				Host:   member.Host,
+				Fields: replset.DiffMember(member, want),
+			})
+			replaces = append(replaces, want)
+			removes = append(removes, member)
+			continue
+		}
+
+		fields := replset.DiffMember(member, want)
+		if len(fields) == 0 {
+			continue
+		}
+		plan.Changes = append(plan.Changes, &Change{
+			Action: ActionModify,
+			Host:   member.Host,
+			Fields: fields,
+		})
+
+		if member.Votes != want.Votes {
+			votes = append(votes, want)
+		}
+
+		// A member can only have priority while it has a vote, so
+		// priority changes for members gaining a vote wait for it.
+		before := *member
+		if member.Votes > 0 || want.Priority == 0 {
+			member.Priority = want.Priority
+		}
+		member.Hidden = want.Hidden
+		member.SlaveDelay = want.SlaveDelay
+		member.Tags = want.Tags
+		if !reflect.DeepEqual(before, *member) {
+			modified = true
+		}
+	}
+	if changes := diffSettings(cur, spec.Settings); len(changes) > 0 {
+		plan.Changes = append(plan.Changes, &Change{
+			Action: ActionModify,
+			Host:   "settings",
+			Fields: changes,
+		})
+		modified = true
+	}
+	if modified {
+		plan.addStep("Update members in place", cur)
+	}
+
+	// New members
+	for _, host := range order {
+		if replset.FindMember(live, host) < 0 {
+			adds = append(adds, desired[host])
+			plan.Changes = append(plan.Changes, &Change{
+				Action: ActionAdd,
+				Host:   host,
+				Fields: describe(desired[host]),
+			})
+		}
+	}
+	plan.addMembers(cur, adds, "Add")
+
+	// Vote changes
+	for _, want := range votes {
+		member := cur.Members[replset.FindMember(cur, want.Host)]
+		member.Votes = want.Votes
+		member.Priority = want.Priority
+		plan.addStep(fmt.Sprintf("Set votes of %s to %d", want.Host, want.Votes), cur)
+	}
+
+	// Removed members
+	for _, member := range removes {
+		if _, ok := desired[member.Host]; !ok {
+			plan.Changes = append(plan.Changes, &Change{
+				Action: ActionRemove,
+				Host:   member.Host,
+			})
+		}
+	}
+	var nonVoting []string
+	for _, member := range removes {
+		if member.Votes == 0 {
+			replset.RemoveMember(cur, member.Host)
+			nonVoting = append(nonVoting, member.Host)
+		}
+	}
+	if len(nonVoting) > 0 {
+		plan.addStep(fmt.Sprintf("Remove non-voting %v", nonVoting), cur)
+	}
+	for _, member := range removes {
+		if member.Votes > 0 {
+			replset.RemoveMember(cur, member.Host)
+			plan.addStep(fmt.Sprintf("Remove %s", member.Host), cur)
+		}
+	}
+
+	// Replaced members
+	plan.addMembers(cur, replaces, "Re-add")
+
+	if err := plan.validate(live); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// validate checks that every step is a configuration MongoDB accepts
+// and changes the vote of at most one member from the step before it,
+// starting from live.
+func (p *Plan) validate(live *commgo.RsConf) error {
+	prev := live
+	for _, step := range p.Steps {
+		if err := replset.ValidateConfig(step.Config); err != nil {
+			return fmt.Errorf("%s: %s", step.Description, err)
+		}
+		if changed := voteChanges(prev, step.Config); len(changed) > 1 {
+			return fmt.Errorf("%s: changes the votes of %v, only one voting member can change per reconfig",
+				step.Description, changed)
+		}
+		prev = step.Config
+	}
+	return nil
+}
+
+// voteChanges returns the hosts whose votes differ between from and to,
+// counting a member which isn't in a configuration as having no vote.
+func voteChanges(from, to *commgo.RsConf) []string {
+	votes := func(config *commgo.RsConf, host string) int {
+		if i := replset.FindMember(config, host); i >= 0 {
+			return config.Members[i].Votes
+		}
+		return 0
+	}
+
+	var changed []string
+	for _, member := range from.Members {
+		if member.Votes != votes(to, member.Host) {
+			changed = append(changed, member.Host)
+		}
+	}
+	for _, member := range to.Members {
+		if replset.FindMember(from, member.Host) < 0 && member.Votes > 0 {
+			changed = append(changed, member.Host)
+		}
+	}
+	return changed
+}
+
+// addMembers adds the given members to cur, non-voting members in a
+// single step and voting members one per step.
+func (p *Plan) addMembers(cur *commgo.RsConf, members []*commgo.Host, verb string) {
+	var nonVoting []string
+	for _, member := range members {
+		if member.Votes == 0 {
+			add := *member
+			add.ID = replset.NextID(cur)
+			cur.Members = append(cur.Members, &add)
+			nonVoting = append(nonVoting, member.Host)
+		}
+	}
+	if len(nonVoting) > 0 {
+		p.addStep(fmt.Sprintf("%s non-voting %v", verb, nonVoting), cur)
+	}
+	for _, member := range members {
+		if member.Votes > 0 {
+			add := *member
+			add.ID = replset.NextID(cur)
+			cur.Members = append(cur.Members, &add)
+			p.addStep(fmt.Sprintf("%s %s", verb, member.Host), cur)
+		}
+	}
+}
+
+func (p *Plan) addStep(description string, config *commgo.RsConf) {
+	p.Steps = append(p.Steps, &Step{
+		Description: description,
+		Config:      replset.CopyConfig(config),
+	})
+}
+
+// Defaults MongoDB uses for a configuration without settings.
+const (
+	DefaultChainingAllowed      = true
+	DefaultHeartbeatTimeoutSecs = 10
+)
+
+// diffSettings applies settings to cur and describes the changes. A
+// configuration without settings is compared with the MongoDB defaults
+// and only given settings once something differs from them.
+func diffSettings(cur *commgo.RsConf, settings *Settings) []string {
+	if settings == nil {
+		return nil
+	}
+	have := commgo.RsSettings{
+		ChainingAllowed:      DefaultChainingAllowed,
+		HeartbeatTimeoutSecs: DefaultHeartbeatTimeoutSecs,
+	}
+	if cur.Settings != nil {
+		have = *cur.Settings
+	}
+
+	var fields []string
+	if v := settings.ChainingAllowed; v != nil && *v != have.ChainingAllowed {
+		fields = append(fields, fmt.Sprintf("chainingAllowed: %v => %v", have.ChainingAllowed, *v))
+		have.ChainingAllowed = *v
+	}
+	if v := settings.HeartbeatTimeoutSecs; v != nil && *v != have.HeartbeatTimeoutSecs {
+		fields = append(fields, fmt.Sprintf("heartbeatTimeoutSecs: %d => %d", have.HeartbeatTimeoutSecs, *v))
+		have.HeartbeatTimeoutSecs = *v
+	}
+	if len(fields) > 0 {
+		cur.Settings = &have
+	}
+	return fields
+}
+
+// describe lists the attributes of a new member.
+func describe(member *commgo.Host) []string {
+	fields := []string{
+		fmt.Sprintf("priority: %v", member.Priority),
+		fmt.Sprintf("votes: %d", member.Votes),
+	}
+	if member.ArbiterOnly {
+		fields = append(fields, "arbiterOnly: true")
+	}
+	if member.Hidden {
+		fields = append(fields, "hidden: true")
+	}
+	if !member.BuildIndexes {
+		fields = append(fields, "buildIndexes: false")
+	}
+	if member.SlaveDelay > 0 {
+		fields = append(fields, fmt.Sprintf("slaveDelay: %d", member.SlaveDelay))
+	}
+	if len(member.Tags) > 0 {
+		fields = append(fields, fmt.Sprintf("tags: %s", replset.FormatTags(member.Tags)))
+	}
+	return fields
+}
@@ -0,0 +1,273 @@
+package spec
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nevins-b/commgo"
+)
+
+func testConfig(hosts ...string) *commgo.RsConf {
+	config := &commgo.RsConf{ID: "rs0", Version: 1}
+	for i, host := range hosts {
+		config.Members = append(config.Members, &commgo.Host{
+			ID:           int64(i),
+			Host:         host,
+			BuildIndexes: true,
+			Votes:        1,
+			Priority:     1,
+		})
+	}
+	return config
+}
+
+func testSpec(hosts ...string) *Spec {
+	spec := &Spec{}
+	for _, host := range hosts {
+		spec.Members = append(spec.Members, &Member{Host: host})
+	}
+	return spec
+}
+
+func TestDiff(t *testing.T) {
+	zero := 0
+	no := false
+	ten := 10
+	twenty := 20
+
+	nonVoting := func(spec *Spec, hosts ...string) *Spec {
+		for _, member := range spec.Members {
+			for _, host := range hosts {
+				if member.Host == host {
+					member.Votes = &zero
+				}
+			}
+		}
+		return spec
+	}
+
+	cases := []struct {
+		name     string
+		live     *commgo.RsConf
+		spec     *Spec
+		steps    []string
+		settings *commgo.RsSettings
+		err      bool
+	}{
+		{
+			name: "unchanged",
+			live: testConfig("a:27017", "b:27017", "c:27017"),
+			spec: testSpec("a:27017", "b:27017", "c:27017"),
+		},
+		{
+			name:  "add voting members one at a time",
+			live:  testConfig("a:27017"),
+			spec:  testSpec("a:27017", "b:27017", "c:27017"),
+			steps: []string{"Add b:27017", "Add c:27017"},
+		},
+		{
+			name:  "add non-voting members together",
+			live:  testConfig("a:27017"),
+			spec:  nonVoting(testSpec("a:27017", "b:27017", "c:27017"), "b:27017", "c:27017"),
+			steps: []string{"Add non-voting [b:27017 c:27017]"},
+		},
+		{
+			name:  "remove voting members one at a time",
+			live:  testConfig("a:27017", "b:27017", "c:27017"),
+			spec:  testSpec("a:27017"),
+			steps: []string{"Remove b:27017", "Remove c:27017"},
+		},
+		{
+			name:  "add before remove",
+			live:  testConfig("a:27017", "b:27017", "c:27017"),
+			spec:  testSpec("a:27017", "b:27017", "d:27017"),
+			steps: []string{"Add d:27017", "Remove c:27017"},
+		},
+		{
+			name:  "take a vote away",
+			live:  testConfig("a:27017", "b:27017", "c:27017"),
+			spec:  nonVoting(testSpec("a:27017", "b:27017", "c:27017"), "c:27017"),
+			steps: []string{"Update members in place", "Set votes of c:27017 to 0"},
+		},
+		{
+			name: "replace to become an arbiter",
+			live: testConfig("a:27017", "b:27017", "c:27017"),
+			spec: func() *Spec {
+				spec := testSpec("a:27017", "b:27017", "c:27017")
+				spec.Members[2].Arbiter = true
+				return spec
+			}(),
+			steps: []string{"Remove c:27017", "Re-add c:27017"},
+		},
+		{
+			name: "settings matching the defaults",
+			live: testConfig("a:27017"),
+			spec: func() *Spec {
+				spec := testSpec("a:27017")
+				spec.Settings = &Settings{HeartbeatTimeoutSecs: &ten}
+				return spec
+			}(),
+		},
+		{
+			name: "settings differing from the defaults",
+			live: testConfig("a:27017"),
+			spec: func() *Spec {
+				spec := testSpec("a:27017")
+				spec.Settings = &Settings{ChainingAllowed: &no}
+				return spec
+			}(),
+			steps:    []string{"Update members in place"},
+			settings: &commgo.RsSettings{ChainingAllowed: false, HeartbeatTimeoutSecs: 10},
+		},
+		{
+			name: "settings differing from the live settings",
+			live: func() *commgo.RsConf {
+				config := testConfig("a:27017")
+				config.Settings = &commgo.RsSettings{ChainingAllowed: true, HeartbeatTimeoutSecs: 10}
+				return config
+			}(),
+			spec: func() *Spec {
+				spec := testSpec("a:27017")
+				spec.Settings = &Settings{HeartbeatTimeoutSecs: &twenty}
+				return spec
+			}(),
+			steps:    []string{"Update members in place"},
+			settings: &commgo.RsSettings{ChainingAllowed: true, HeartbeatTimeoutSecs: 20},
+		},
+		{
+			name: "wrong replica set",
+			live: testConfig("a:27017"),
+			spec: func() *Spec {
+				spec := testSpec("a:27017")
+				spec.Name = "rs1"
+				return spec
+			}(),
+			err: true,
+		},
+		{
+			name: "step without an electable member",
+			live: testConfig("a:27017"),
+			spec: func() *Spec {
+				spec := testSpec("a:27017")
+				priority := 0.0
+				spec.Members[0].Priority = &priority
+				return spec
+			}(),
+			err: true,
+		},
+	}
+
+	for _, tc := range cases {
+		plan, err := Diff(tc.live, tc.spec)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tc.name, err)
+			continue
+		}
+
+		var steps []string
+		for _, step := range plan.Steps {
+			steps = append(steps, step.Description)
+		}
+		if !reflect.DeepEqual(steps, tc.steps) {
+			t.Errorf("%s: expected steps %q, got %q", tc.name, tc.steps, steps)
+		}
+		if plan.Empty() {
+			continue
+		}
+
+		final := plan.Steps[len(plan.Steps)-1].Config
+		if !reflect.DeepEqual(final.Settings, tc.settings) {
+			t.Errorf("%s: expected settings %#v, got %#v", tc.name, tc.settings, final.Settings)
+		}
+		var hosts []string
+		for _, member := range final.Members {
+			hosts = append(hosts, member.Host)
+		}
+		var want []string
+		for _, member := range tc.spec.Members {
+			want = append(want, member.Host)
+		}
+		if !reflect.DeepEqual(hosts, want) {
+			t.Errorf("%s: expected members %v, got %v", tc.name, want, hosts)
+		}
+	}
+}
+
+func TestDiffDoesNotModifyLive(t *testing.T) {
+	live := testConfig("a:27017", "b:27017", "c:27017")
+	before := testConfig("a:27017", "b:27017", "c:27017")
+
+	spec := testSpec("a:27017", "d:27017")
+	no := false
+	spec.Settings = &Settings{ChainingAllowed: &no}
+	if _, err := Diff(live, spec); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(live, before) {
+		t.Errorf("live configuration was modified: %#v", live)
+	}
+}
+
+func TestVoteChanges(t *testing.T) {
+	cases := []struct {
+		name    string
+		from    *commgo.RsConf
+		to      *commgo.RsConf
+		changed []string
+	}{
+		{
+			name: "unchanged",
+			from: testConfig("a", "b"),
+			to:   testConfig("a", "b"),
+		},
+		{
+			name:    "voting member added",
+			from:    testConfig("a"),
+			to:      testConfig("a", "b"),
+			changed: []string{"b"},
+		},
+		{
+			name:    "voting member removed",
+			from:    testConfig("a", "b"),
+			to:      testConfig("a"),
+			changed: []string{"b"},
+		},
+		{
+			name: "non-voting member added",
+			from: testConfig("a"),
+			to: func() *commgo.RsConf {
+				config := testConfig("a", "b")
+				config.Members[1].Votes = 0
+				return config
+			}(),
+		},
+		{
+			name:    "two voting members added",
+			from:    testConfig("a"),
+			to:      testConfig("a", "b", "c"),
+			changed: []string{"b", "c"},
+		},
+		{
+			name: "vote taken away",
+			from: testConfig("a", "b"),
+			to: func() *commgo.RsConf {
+				config := testConfig("a", "b")
+				config.Members[0].Votes = 0
+				return config
+			}(),
+			changed: []string{"a"},
+		},
+	}
+
+	for _, tc := range cases {
+		if changed := voteChanges(tc.from, tc.to); !reflect.DeepEqual(changed, tc.changed) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.changed, changed)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package spec
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/aocsolutions/mongoctl/replset"
+	"github.com/hashicorp/hcl"
+	"github.com/mitchellh/go-homedir"
+	"github.com/nevins-b/commgo"
+)
+
+// Spec is the desired state of a replica set, read from an HCL or
+// JSON file such as:
+//
+//	name = "rs0"
+//
+//	member "10.0.0.1:27017" {
+//	  priority = 2
+//	  tags = { dc = "east" }
+//	}
+//
+//	member "10.0.0.2:27017" {
+//	  hidden      = true
+//	  slave_delay = 3600
+//	}
+//
+//	member "10.0.0.3:27017" {
+//	  arbiter = true
+//	}
+type Spec struct {
+	// Name, if set, must match the _id of the live replica set.
+	Name string `hcl:"name"`
+
+	Members  []*Member `hcl:"member"`
+	Settings *Settings `hcl:"settings"`
+}
+
+// Member is the desired configuration of a single member. Unset
+// values take the MongoDB defaults, except that priority defaults to 0
+// for members which can not be elected.
+type Member struct {
+	Host         string            `hcl:",key"`
+	Priority     *float64          `hcl:"priority"`
+	Votes        *int              `hcl:"votes"`
+	Hidden       bool              `hcl:"hidden"`
+	Arbiter      bool              `hcl:"arbiter"`
+	BuildIndexes *bool             `hcl:"build_indexes"`
+	SlaveDelay   int64             `hcl:"slave_delay"`
+	Tags         map[string]string `hcl:"tags"`
+}
+
+// Settings are the replica set wide settings. Only settings which are
+// given are changed.
+type Settings struct {
+	ChainingAllowed      *bool `hcl:"chaining_allowed"`
+	HeartbeatTimeoutSecs *int  `hcl:"heartbeat_timeout_secs"`
+}
+
+// LoadSpec reads and validates the spec at path.
+func LoadSpec(path string) (*Spec, error) {
+	path, err := homedir.Expand(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error expanding spec path: %s", err)
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := hcl.Parse(string(contents))
+	if err != nil {
+		return nil, err
+	}
+
+	var spec Spec
+	if err := hcl.DecodeObject(&spec, obj); err != nil {
+		return nil, err
+	}
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// Validate checks that the spec describes a configuration MongoDB
+// would accept.
+func (s *Spec) Validate() error {
+	config := &commgo.RsConf{}
+	for i, member := range s.Members {
+		config.Members = append(config.Members, member.Config(int64(i)))
+	}
+	return replset.ValidateConfig(config)
+}
+
+// Config returns the member as it would appear in a replica set
+// configuration with the given id.
+func (m *Member) Config(id int64) *commgo.Host {
+	host := &commgo.Host{
+		ID:           id,
+		Host:         m.Host,
+		ArbiterOnly:  m.Arbiter,
+		BuildIndexes: true,
+		Hidden:       m.Hidden,
+		SlaveDelay:   m.SlaveDelay,
+		Votes:        1,
+		Priority:     1,
+	}
+	if m.Votes != nil {
+		host.Votes = *m.Votes
+	}
+	if m.BuildIndexes != nil {
+		host.BuildIndexes = *m.BuildIndexes
+	}
+	if m.Arbiter || m.Hidden || m.SlaveDelay > 0 || host.Votes == 0 || !host.BuildIndexes {
+		host.Priority = 0
+	}
+	if m.Priority != nil {
+		host.Priority = *m.Priority
+	}
+	if len(m.Tags) > 0 {
+		host.Tags = make(map[string]string, len(m.Tags))
+		for k, v := range m.Tags {
+			host.Tags[k] = v
+		}
+	}
+	return host
+}